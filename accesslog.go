@@ -0,0 +1,77 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// WithAccessLog logs a summary of every invocation to the logger at the given level. Invocations that
+// return an error are logged at the error level. If logger is nil, slog.Default() is used.
+//
+// The logger is also used as the base of the logger returned by GetLogger.
+func WithAccessLog(logger *slog.Logger, level slog.Level) Option {
+	return func(lh *LambdaHandler) {
+		if logger == nil {
+			logger = slog.Default()
+		}
+		lh.accessLog = logger
+		lh.accessLogLevel = level
+	}
+}
+
+type loggerContextKey struct{}
+
+// GetLogger returns a logger for the request, with the API Gateway request ID and X-Ray trace ID
+// attributes. The logger configured with WithAccessLog is used, or slog.Default() if none is configured.
+func GetLogger(ctx context.Context) *slog.Logger {
+	logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger)
+	if !ok {
+		logger = slog.Default()
+	}
+	var attrs []any
+	if e, ok := GetEvent(ctx); ok {
+		attrs = append(attrs, slog.String("requestId", e.RequestContext.RequestID))
+	}
+	if th, ok := GetTraceHeader(ctx); ok {
+		// The @xrayTraceId field links log entries to X-Ray traces in the AWS console.
+		attrs = append(attrs, slog.String("@xrayTraceId", th.Root))
+	}
+	return logger.With(attrs...)
+}
+
+func (lh LambdaHandler) logAccess(ctx context.Context, e events.APIGatewayV2HTTPRequest, resp events.APIGatewayV2HTTPResponse, responseBytes int, err error, duration time.Duration, coldStart bool) {
+	level := lh.accessLogLevel
+	attrs := []slog.Attr{
+		slog.String("requestId", e.RequestContext.RequestID),
+		slog.String("routeKey", e.RouteKey),
+		slog.String("method", e.RequestContext.HTTP.Method),
+		slog.String("path", e.RawPath),
+		slog.Int("status", resp.StatusCode),
+		slog.Int("bytes", responseBytes),
+		slog.Bool("base64", resp.IsBase64Encoded),
+		slog.Duration("duration", duration),
+		slog.Bool("coldStart", coldStart),
+		slog.String("sourceIp", e.RequestContext.HTTP.SourceIP),
+		slog.String("userAgent", e.RequestContext.HTTP.UserAgent),
+	}
+	if th, ok := GetTraceHeader(ctx); ok {
+		attrs = append(attrs, slog.String("@xrayTraceId", th.Root))
+	}
+	if err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	lh.accessLog.LogAttrs(ctx, level, "request", attrs...)
+}
+
+// bodyLength returns the length of the decoded body.
+func bodyLength(body string, isBase64 bool) int {
+	if !isBase64 {
+		return len(body)
+	}
+	return len(body)/4*3 - strings.Count(body[max(len(body)-2, 0):], "=")
+}
@@ -0,0 +1,226 @@
+package awsapigatewayv2handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAccessLog(t *testing.T) {
+	ignoreVariable := func(entry map[string]any) map[string]any {
+		delete(entry, "time")
+		delete(entry, "duration")
+		delete(entry, "coldStart")
+		return entry
+	}
+	event := events.APIGatewayV2HTTPRequest{
+		RouteKey: "GET /hello",
+		RawPath:  "/hello",
+		Headers: map[string]string{
+			"x-amzn-trace-id": "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1",
+		},
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RequestID: "request-id",
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    http.MethodGet,
+				SourceIP:  "192.0.2.1",
+				UserAgent: "curl/7.79.1",
+			},
+		},
+	}
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		opts     []Option
+		expected map[string]any
+	}{
+		{
+			name: "successful requests are logged at the configured level",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "Hello")
+			}),
+			expected: map[string]any{
+				"level":        "INFO",
+				"msg":          "request",
+				"requestId":    "request-id",
+				"routeKey":     "GET /hello",
+				"method":       "GET",
+				"path":         "/hello",
+				"status":       float64(200),
+				"bytes":        float64(5),
+				"base64":       false,
+				"sourceIp":     "192.0.2.1",
+				"userAgent":    "curl/7.79.1",
+				"@xrayTraceId": "1-5759e988-bd862e3fe1be46a994272793",
+			},
+		},
+		{
+			name: "bytes are the length of the decoded body",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				w.Write([]byte{0, 1, 2, 3})
+			}),
+			expected: map[string]any{
+				"level":        "INFO",
+				"msg":          "request",
+				"requestId":    "request-id",
+				"routeKey":     "GET /hello",
+				"method":       "GET",
+				"path":         "/hello",
+				"status":       float64(200),
+				"bytes":        float64(4),
+				"base64":       true,
+				"sourceIp":     "192.0.2.1",
+				"userAgent":    "curl/7.79.1",
+				"@xrayTraceId": "1-5759e988-bd862e3fe1be46a994272793",
+			},
+		},
+		{
+			name:    "errors are logged at the error level",
+			handler: http.NotFoundHandler(),
+			opts: []Option{
+				WithBeforeRequest(func(ctx context.Context, e *events.APIGatewayV2HTTPRequest) error {
+					return errors.New("rejected")
+				}),
+			},
+			expected: map[string]any{
+				"level":        "ERROR",
+				"msg":          "request",
+				"requestId":    "request-id",
+				"routeKey":     "GET /hello",
+				"method":       "GET",
+				"path":         "/hello",
+				"status":       float64(0),
+				"bytes":        float64(0),
+				"base64":       false,
+				"sourceIp":     "192.0.2.1",
+				"userAgent":    "curl/7.79.1",
+				"@xrayTraceId": "1-5759e988-bd862e3fe1be46a994272793",
+				"error":        "rejected",
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, nil))
+			lh := NewLambdaHandler(tt.handler, append(tt.opts, WithAccessLog(logger, slog.LevelInfo))...)
+
+			// Act.
+			lh.Handle(context.Background(), event)
+
+			// Assert.
+			var actual map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &actual); err != nil {
+				t.Fatalf("failed to parse log entry %q: %v", buf.String(), err)
+			}
+			if _, ok := actual["duration"]; !ok {
+				t.Error("expected duration to be logged")
+			}
+			if _, ok := actual["coldStart"]; !ok {
+				t.Error("expected coldStart to be logged")
+			}
+			if diff := cmp.Diff(tt.expected, ignoreVariable(actual)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+	t.Run("no access log is written by default", func(t *testing.T) {
+		// Arrange.
+		var buf bytes.Buffer
+		defer slog.SetDefault(slog.Default())
+		slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+		lh := NewLambdaHandler(http.NotFoundHandler())
+
+		// Act.
+		lh.Handle(context.Background(), event)
+
+		// Assert.
+		if buf.Len() != 0 {
+			t.Errorf("expected no log entries, got %q", buf.String())
+		}
+	})
+}
+
+func TestGetLogger(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      func(ctx context.Context) context.Context
+		headers  map[string]string
+		expected map[string]any
+	}{
+		{
+			name: "the trace ID is read from the Lambda context",
+			ctx: func(ctx context.Context) context.Context {
+				return context.WithValue(ctx, "x-amzn-trace-id", "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1")
+			},
+			expected: map[string]any{
+				"level":        "INFO",
+				"msg":          "message",
+				"requestId":    "request-id",
+				"@xrayTraceId": "1-5759e988-bd862e3fe1be46a994272793",
+			},
+		},
+		{
+			name: "the trace ID is read from the header if it's not in the context",
+			headers: map[string]string{
+				"x-amzn-trace-id": "Root=1-63441c4a-abcdef012345678912345678",
+			},
+			expected: map[string]any{
+				"level":        "INFO",
+				"msg":          "message",
+				"requestId":    "request-id",
+				"@xrayTraceId": "1-63441c4a-abcdef012345678912345678",
+			},
+		},
+		{
+			name: "the trace ID is omitted if there isn't one",
+			expected: map[string]any{
+				"level":     "INFO",
+				"msg":       "message",
+				"requestId": "request-id",
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, nil))
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				GetLogger(r.Context()).Info("message")
+			})
+			ctx := context.Background()
+			if tt.ctx != nil {
+				ctx = tt.ctx(ctx)
+			}
+			e := events.APIGatewayV2HTTPRequest{RawPath: "/", Headers: tt.headers}
+			e.RequestContext.RequestID = "request-id"
+
+			// Act.
+			// Log access below the handler's level, so that only the handler's log entry is written.
+			NewLambdaHandler(h, WithAccessLog(logger, slog.LevelDebug)).Handle(ctx, e)
+
+			// Assert.
+			var actual map[string]any
+			if err := json.NewDecoder(&buf).Decode(&actual); err != nil {
+				t.Fatalf("failed to parse log entry %q: %v", buf.String(), err)
+			}
+			delete(actual, "time")
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
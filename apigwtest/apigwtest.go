@@ -0,0 +1,24 @@
+// Package apigwtest provides utilities for testing API Gateway V2 Lambda handlers, in the style of
+// net/http/httptest.
+package apigwtest
+
+import (
+	"io"
+	"net/http/httptest"
+
+	"github.com/a-h/awsapigatewayv2handler"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// NewRequest returns a new API Gateway V2 event, as API Gateway would send it to a Lambda function if it
+// received the HTTP request. The method, target and body parameters are interpreted in the same way as
+// httptest.NewRequest.
+//
+// NewRequest panics on error, for ease of use in testing.
+func NewRequest(method, target string, body io.Reader) events.APIGatewayV2HTTPRequest {
+	e, err := awsapigatewayv2handler.NewEvent(httptest.NewRequest(method, target, body))
+	if err != nil {
+		panic("invalid NewRequest arguments; " + err.Error())
+	}
+	return e
+}
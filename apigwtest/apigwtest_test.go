@@ -0,0 +1,84 @@
+package apigwtest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/a-h/awsapigatewayv2handler"
+)
+
+func TestNewRequest(t *testing.T) {
+	e := NewRequest(http.MethodPost, "/path?a=1", strings.NewReader("body"))
+	if e.RequestContext.HTTP.Method != http.MethodPost {
+		t.Errorf("expected method POST, got %q", e.RequestContext.HTTP.Method)
+	}
+	if e.RawPath != "/path" {
+		t.Errorf("expected raw path /path, got %q", e.RawPath)
+	}
+	if e.RawQueryString != "a=1" {
+		t.Errorf("expected raw querystring a=1, got %q", e.RawQueryString)
+	}
+	if e.Body != "body" {
+		t.Errorf("expected body, got %q", e.Body)
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add("GET", "/path", "a=1", "", []byte{})
+	f.Add("POST", "/a%2Fb/c", "", "application/json", []byte(`{"key":"value"}`))
+	f.Add("PUT", "//double/slash", "x", "image/png", []byte{0, 1, 2, 3})
+	f.Add("PATCH", "/café", "", "text/plain", []byte{0xff, 0xfe})
+	f.Fuzz(func(t *testing.T, method, path, query, contentType string, body []byte) {
+		if !strings.HasPrefix(path, "/") {
+			// API Gateway paths always start with a slash.
+			return
+		}
+		r, err := http.NewRequest(method, "/", bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		if method == "" {
+			method = http.MethodGet
+		}
+		r.URL = &url.URL{Path: path, RawQuery: query}
+		r.Header.Set("Content-Type", contentType)
+		e, err := awsapigatewayv2handler.NewEvent(r)
+		if err != nil {
+			t.Fatalf("failed to create event: %v", err)
+		}
+		var called bool
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			if r.Method != method {
+				t.Errorf("expected method %q, got %q", method, r.Method)
+			}
+			if r.URL.Path != path {
+				t.Errorf("expected path %q, got %q", path, r.URL.Path)
+			}
+			if r.URL.RawQuery != query {
+				t.Errorf("expected query %q, got %q", query, r.URL.RawQuery)
+			}
+			actualBody, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+			if !bytes.Equal(body, actualBody) {
+				t.Errorf("expected body %q, got %q", body, actualBody)
+			}
+			if r.ContentLength != int64(len(body)) && !(len(body) == 0 && r.ContentLength <= 0) {
+				t.Errorf("expected content length %d, got %d", len(body), r.ContentLength)
+			}
+		})
+		if _, err = awsapigatewayv2handler.NewLambdaHandler(h).Handle(context.Background(), e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !called {
+			t.Error("handler was not called")
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package apigwtest
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/a-h/awsapigatewayv2handler"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// NewConnections creates an in-memory implementation of awsapigatewayv2handler.WebSocketConnections.
+func NewConnections() *Connections {
+	return &Connections{
+		messages: make(map[string][][]byte),
+		deleted:  make(map[string]bool),
+	}
+}
+
+// Connections records the messages sent to WebSocket connections. Posting to a deleted connection returns
+// a 410 Gone error, like the API Gateway Management API.
+type Connections struct {
+	m        sync.Mutex
+	messages map[string][][]byte
+	deleted  map[string]bool
+}
+
+func (c *Connections) PostToConnection(ctx context.Context, connectionID string, data []byte) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.deleted[connectionID] {
+		return gone(connectionID)
+	}
+	c.messages[connectionID] = append(c.messages[connectionID], append([]byte{}, data...))
+	return nil
+}
+
+func (c *Connections) DeleteConnection(ctx context.Context, connectionID string) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.deleted[connectionID] {
+		return gone(connectionID)
+	}
+	c.deleted[connectionID] = true
+	return nil
+}
+
+// Get returns the messages sent to the connection.
+func (c *Connections) Get(connectionID string) [][]byte {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return slices.Clone(c.messages[connectionID])
+}
+
+// IsDeleted returns true if the connection has been deleted.
+func (c *Connections) IsDeleted(connectionID string) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.deleted[connectionID]
+}
+
+func gone(connectionID string) error {
+	return &awsapigatewayv2handler.WebSocketManagementError{
+		ConnectionID: connectionID,
+		StatusCode:   http.StatusGone,
+		Message:      `{"message":"Gone"}`,
+	}
+}
+
+// NewWebSocketEvent returns a WebSocket API event. The eventType is CONNECT, MESSAGE or DISCONNECT.
+func NewWebSocketEvent(eventType, connectionID, body string) events.APIGatewayWebsocketProxyRequest {
+	routeKey := map[string]string{
+		"CONNECT":    "$connect",
+		"MESSAGE":    "$default",
+		"DISCONNECT": "$disconnect",
+	}[eventType]
+	return events.APIGatewayWebsocketProxyRequest{
+		Body: body,
+		RequestContext: events.APIGatewayWebsocketProxyRequestContext{
+			RouteKey:     routeKey,
+			EventType:    eventType,
+			ConnectionID: connectionID,
+			DomainName:   "example.execute-api.us-east-1.amazonaws.com",
+			Stage:        "test",
+			RequestID:    "test-request-id",
+			ConnectedAt:  1658571152000,
+		},
+	}
+}
@@ -0,0 +1,130 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// AuthorizerResult is the result of a Lambda authorizer.
+type AuthorizerResult struct {
+	IsAuthorized bool
+	// PrincipalID identifies the caller in the IAM policy response format.
+	PrincipalID string
+	// Context is passed to the integration. Lambda functions can read it from the
+	// RequestContext.Authorizer.Lambda field of the event.
+	Context map[string]any
+	// Resources are the route ARNs that the IAM policy allows or denies. Defaults to the route ARN of the
+	// request. Only used by the IAM policy response format.
+	Resources []string
+}
+
+// AuthorizerFunc authorizes a request. If it returns an error, the error is returned from the Lambda
+// function, and API Gateway responds with a 500 Internal Server Error.
+type AuthorizerFunc func(r *http.Request) (AuthorizerResult, error)
+
+// NewAuthorizer creates a Lambda authorizer for API Gateway HTTP APIs (payload format 2.0) that converts
+// the authorizer request into a *http.Request. By default, the simple response format is used.
+func NewAuthorizer(f AuthorizerFunc) Authorizer {
+	return Authorizer{
+		Func: f,
+	}
+}
+
+// Authorizer is a Lambda authorizer for API Gateway HTTP APIs.
+type Authorizer struct {
+	Func AuthorizerFunc
+	// IAMPolicy sets the response format to an IAM policy, instead of the simple response format. The
+	// format must match the EnableSimpleResponses setting of the API Gateway authorizer.
+	IAMPolicy bool
+}
+
+func (a Authorizer) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	var e events.APIGatewayV2CustomAuthorizerV2Request
+	err := json.Unmarshal(payload, &e)
+	if err != nil {
+		return nil, err
+	}
+	if a.IAMPolicy {
+		resp, err := a.HandleIAMPolicy(ctx, e)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(resp)
+	}
+	resp, err := a.HandleSimple(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
+
+// HandleSimple returns a simple format response.
+func (a Authorizer) HandleSimple(ctx context.Context, e events.APIGatewayV2CustomAuthorizerV2Request) (resp events.APIGatewayV2CustomAuthorizerSimpleResponse, err error) {
+	result, err := a.authorize(ctx, e)
+	if err != nil {
+		return
+	}
+	resp.IsAuthorized = result.IsAuthorized
+	resp.Context = result.Context
+	return
+}
+
+// HandleIAMPolicy returns an IAM policy format response, which allows or denies execute-api:Invoke.
+func (a Authorizer) HandleIAMPolicy(ctx context.Context, e events.APIGatewayV2CustomAuthorizerV2Request) (resp events.APIGatewayV2CustomAuthorizerIAMPolicyResponse, err error) {
+	result, err := a.authorize(ctx, e)
+	if err != nil {
+		return
+	}
+	effect := "Deny"
+	if result.IsAuthorized {
+		effect = "Allow"
+	}
+	resources := result.Resources
+	if len(resources) == 0 {
+		resources = []string{e.RouteArn}
+	}
+	resp.PrincipalID = result.PrincipalID
+	resp.PolicyDocument = events.APIGatewayCustomAuthorizerPolicy{
+		Version: "2012-10-17",
+		Statement: []events.IAMPolicyStatement{
+			{
+				Action:   []string{"execute-api:Invoke"},
+				Effect:   effect,
+				Resource: resources,
+			},
+		},
+	}
+	resp.Context = result.Context
+	return
+}
+
+type authorizerRequestContextKey struct{}
+
+// GetAuthorizerRequest returns the Lambda authorizer request from the context of a request.
+func GetAuthorizerRequest(ctx context.Context) (e events.APIGatewayV2CustomAuthorizerV2Request, ok bool) {
+	e, ok = ctx.Value(authorizerRequestContextKey{}).(events.APIGatewayV2CustomAuthorizerV2Request)
+	return
+}
+
+func (a Authorizer) authorize(ctx context.Context, e events.APIGatewayV2CustomAuthorizerV2Request) (result AuthorizerResult, err error) {
+	// Authorizer requests are the same as HTTP requests, except that they don't have a body.
+	r, err := LambdaHandler{}.convertLambdaEventToHTTPRequest(events.APIGatewayV2HTTPRequest{
+		RouteKey:              e.RouteKey,
+		RawPath:               e.RawPath,
+		RawQueryString:        e.RawQueryString,
+		Cookies:               e.Cookies,
+		Headers:               e.Headers,
+		QueryStringParameters: e.QueryStringParameters,
+		PathParameters:        e.PathParameters,
+		StageVariables:        e.StageVariables,
+		RequestContext:        e.RequestContext,
+	})
+	if err != nil {
+		// Requests that couldn't be sent to a Lambda function aren't authorized.
+		return result, nil
+	}
+	return a.Func(r.WithContext(context.WithValue(ctx, authorizerRequestContextKey{}, e)))
+}
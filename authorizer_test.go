@@ -0,0 +1,177 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAuthorizer(t *testing.T) {
+	event := events.APIGatewayV2CustomAuthorizerV2Request{
+		Version:        "2.0",
+		Type:           "REQUEST",
+		RouteArn:       "arn:aws:execute-api:us-east-1:123456789012:abcdef123/$default/GET/orders",
+		IdentitySource: []string{"secret-token"},
+		RouteKey:       "GET /orders",
+		RawPath:        "/orders",
+		RawQueryString: "a=1",
+		Cookies:        []string{"session=abc"},
+		Headers: map[string]string{
+			"authorization": "secret-token",
+			"host":          "abcdef123.execute-api.us-east-1.amazonaws.com",
+		},
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method: http.MethodGet,
+			},
+		},
+	}
+	authorize := func(r *http.Request) (AuthorizerResult, error) {
+		if _, ok := GetAuthorizerRequest(r.Context()); !ok {
+			return AuthorizerResult{}, errors.New("expected authorizer request in context")
+		}
+		if r.Method != http.MethodGet || r.URL.String() != "/orders?a=1" || r.Host != "abcdef123.execute-api.us-east-1.amazonaws.com" {
+			return AuthorizerResult{}, errors.New("unexpected request " + r.Method + " " + r.Host + r.URL.String())
+		}
+		if c, err := r.Cookie("session"); err != nil || c.Value != "abc" {
+			return AuthorizerResult{}, errors.New("expected session cookie")
+		}
+		if r.Header.Get("Authorization") != "secret-token" {
+			return AuthorizerResult{IsAuthorized: false, PrincipalID: "anonymous"}, nil
+		}
+		return AuthorizerResult{
+			IsAuthorized: true,
+			PrincipalID:  "user-1",
+			Context:      map[string]any{"userId": "user-1"},
+		}, nil
+	}
+	unauthorizedEvent := event
+	unauthorizedEvent.Headers = map[string]string{
+		"authorization": "wrong",
+		"host":          "abcdef123.execute-api.us-east-1.amazonaws.com",
+	}
+	tests := []struct {
+		name     string
+		a        Authorizer
+		event    events.APIGatewayV2CustomAuthorizerV2Request
+		expected any
+	}{
+		{
+			name:  "simple responses",
+			a:     NewAuthorizer(authorize),
+			event: event,
+			expected: map[string]any{
+				"isAuthorized": true,
+				"context":      map[string]any{"userId": "user-1"},
+			},
+		},
+		{
+			name:  "simple responses can deny access",
+			a:     NewAuthorizer(authorize),
+			event: unauthorizedEvent,
+			expected: map[string]any{
+				"isAuthorized": false,
+			},
+		},
+		{
+			name:  "IAM policy responses",
+			a:     Authorizer{Func: authorize, IAMPolicy: true},
+			event: event,
+			expected: map[string]any{
+				"principalId": "user-1",
+				"policyDocument": map[string]any{
+					"Version": "2012-10-17",
+					"Statement": []any{
+						map[string]any{
+							"Action":   []any{"execute-api:Invoke"},
+							"Effect":   "Allow",
+							"Resource": []any{"arn:aws:execute-api:us-east-1:123456789012:abcdef123/$default/GET/orders"},
+						},
+					},
+				},
+				"context": map[string]any{"userId": "user-1"},
+			},
+		},
+		{
+			name:  "IAM policy responses can deny access",
+			a:     Authorizer{Func: authorize, IAMPolicy: true},
+			event: unauthorizedEvent,
+			expected: map[string]any{
+				"principalId": "anonymous",
+				"policyDocument": map[string]any{
+					"Version": "2012-10-17",
+					"Statement": []any{
+						map[string]any{
+							"Action":   []any{"execute-api:Invoke"},
+							"Effect":   "Deny",
+							"Resource": []any{"arn:aws:execute-api:us-east-1:123456789012:abcdef123/$default/GET/orders"},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			payload, err := json.Marshal(tt.event)
+			if err != nil {
+				t.Fatalf("failed to marshal event: %v", err)
+			}
+
+			// Act.
+			respPayload, err := tt.a.Invoke(context.Background(), payload)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var actual map[string]any
+			if err = json.Unmarshal(respPayload, &actual); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, any(actual)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+	t.Run("errors are returned", func(t *testing.T) {
+		// Arrange.
+		a := NewAuthorizer(func(r *http.Request) (AuthorizerResult, error) {
+			return AuthorizerResult{}, errors.New("database unavailable")
+		})
+
+		// Act.
+		_, err := a.HandleSimple(context.Background(), event)
+
+		// Assert.
+		if err == nil {
+			t.Error("expected error")
+		}
+	})
+	t.Run("invalid requests are denied", func(t *testing.T) {
+		// Arrange.
+		a := NewAuthorizer(func(r *http.Request) (AuthorizerResult, error) {
+			return AuthorizerResult{IsAuthorized: true}, nil
+		})
+		invalid := event
+		invalid.RequestContext.HTTP.Method = "BAD METHOD"
+
+		// Act.
+		resp, err := a.HandleSimple(context.Background(), invalid)
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.IsAuthorized {
+			t.Error("expected invalid request to be denied")
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package awsapigatewayv2handler
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// WithTrustedProxies trusts the X-Forwarded-For header of requests from the proxies, e.g. the CloudFront
+// origin-facing IP ranges, if API Gateway is behind CloudFront.
+//
+// By default, the client IP address is the source IP address of the API Gateway event, which is the
+// address of the last proxy. When the source IP address is trusted, the X-Forwarded-For header is read
+// from right to left, and the first address that isn't trusted is the client IP address.
+func WithTrustedProxies(prefixes ...netip.Prefix) Option {
+	return func(lh *LambdaHandler) {
+		lh.trustedProxies = append(lh.trustedProxies, prefixes...)
+	}
+}
+
+// ClientIP returns the IP address of the client, from the request's RemoteAddr.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// remoteAddr returns the client IP address with a port of 0, since API Gateway doesn't include the port.
+func (lh LambdaHandler) remoteAddr(e events.APIGatewayV2HTTPRequest) string {
+	ip := e.RequestContext.HTTP.SourceIP
+	if ip == "" {
+		return ""
+	}
+	if lh.isTrustedProxy(ip) {
+		forwardedFor := strings.Split(getHeader(e.Headers, "x-forwarded-for"), ",")
+		for i := len(forwardedFor) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(forwardedFor[i]))
+			if err != nil {
+				break
+			}
+			ip = addr.String()
+			if !lh.isTrustedProxy(ip) {
+				break
+			}
+		}
+	}
+	return net.JoinHostPort(ip, "0")
+}
+
+func (lh LambdaHandler) isTrustedProxy(ip string) bool {
+	if len(lh.trustedProxies) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range lh.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
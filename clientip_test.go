@@ -0,0 +1,108 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestClientIP(t *testing.T) {
+	cloudFront := []netip.Prefix{netip.MustParsePrefix("130.176.0.0/16"), netip.MustParsePrefix("2600:9000::/28")}
+	tests := []struct {
+		name           string
+		trustedProxies []netip.Prefix
+		sourceIP       string
+		forwardedFor   string
+		expected       string
+	}{
+		{
+			name:         "the source IP is used by default",
+			sourceIP:     "198.51.100.24",
+			forwardedFor: "203.0.113.7, 198.51.100.24",
+			expected:     "198.51.100.24",
+		},
+		{
+			name:           "the source IP is used if it's not trusted",
+			trustedProxies: cloudFront,
+			sourceIP:       "198.51.100.24",
+			forwardedFor:   "203.0.113.7, 198.51.100.24",
+			expected:       "198.51.100.24",
+		},
+		{
+			name:           "X-Forwarded-For is used if the source IP is trusted",
+			trustedProxies: cloudFront,
+			sourceIP:       "130.176.1.2",
+			forwardedFor:   "203.0.113.7, 198.51.100.24",
+			expected:       "198.51.100.24",
+		},
+		{
+			name:           "trusted proxies are skipped",
+			trustedProxies: cloudFront,
+			sourceIP:       "130.176.1.2",
+			forwardedFor:   "203.0.113.7, 198.51.100.24, 130.176.3.4",
+			expected:       "198.51.100.24",
+		},
+		{
+			name:           "IPv6 addresses are supported",
+			trustedProxies: cloudFront,
+			sourceIP:       "2600:9000:2000::1",
+			forwardedFor:   "2001:db8::1",
+			expected:       "2001:db8::1",
+		},
+		{
+			name:           "invalid addresses stop the search",
+			trustedProxies: cloudFront,
+			sourceIP:       "130.176.1.2",
+			forwardedFor:   "203.0.113.7, unknown, 130.176.3.4",
+			expected:       "130.176.3.4",
+		},
+		{
+			name:           "the source IP is used if there's no X-Forwarded-For header",
+			trustedProxies: cloudFront,
+			sourceIP:       "130.176.1.2",
+			expected:       "130.176.1.2",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			var actual string
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actual = ClientIP(r)
+			})
+			e := events.APIGatewayV2HTTPRequest{RawPath: "/", Headers: map[string]string{}}
+			if tt.forwardedFor != "" {
+				e.Headers["x-forwarded-for"] = tt.forwardedFor
+			}
+			e.RequestContext.HTTP.SourceIP = tt.sourceIP
+
+			// Act.
+			_, err := NewLambdaHandler(h, WithTrustedProxies(tt.trustedProxies...)).Handle(context.Background(), e)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+	t.Run("the remote address of other requests is used", func(t *testing.T) {
+		// Arrange.
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		// Act.
+		actual := ClientIP(r)
+
+		// Assert.
+		if actual != "192.0.2.1" {
+			t.Errorf("expected %q, got %q", "192.0.2.1", actual)
+		}
+	})
+}
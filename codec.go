@@ -0,0 +1,61 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// JSONCodec marshals and unmarshals the events handled by Invoke, e.g. to use a faster JSON library.
+type JSONCodec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// DefaultJSONCodec is the codec used by Invoke if WithJSONCodec isn't used. API Gateway responses are
+// marshalled to the same output as encoding/json, without reflection. Requests are unmarshalled without
+// copying the body through encoding/json, except that the body of base64 encoded requests isn't validated
+// until it's decoded. Other types use encoding/json.
+type DefaultJSONCodec struct{}
+
+func (DefaultJSONCodec) Marshal(v any) ([]byte, error) {
+	switch resp := v.(type) {
+	case events.APIGatewayV2HTTPResponse:
+		return encodeResponse(resp, nil), nil
+	case *events.APIGatewayV2HTTPResponse:
+		if resp != nil {
+			return encodeResponse(*resp, nil), nil
+		}
+	}
+	return json.Marshal(v)
+}
+
+func (DefaultJSONCodec) Unmarshal(data []byte, v any) error {
+	if e, ok := v.(*events.APIGatewayV2HTTPRequest); ok && e != nil {
+		return decodeRequest(data, e)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WithJSONCodec uses the codec to unmarshal API Gateway events and marshal the responses in Invoke,
+// instead of DefaultJSONCodec. Binary response bodies are base64 encoded before they're passed to the
+// codec, rather than straight into the response.
+func WithJSONCodec(codec JSONCodec) Option {
+	return func(lh *LambdaHandler) {
+		lh.codec = codec
+	}
+}
+
+func (lh LambdaHandler) invokeWithCodec(ctx context.Context, payload []byte) ([]byte, error) {
+	var req events.APIGatewayV2HTTPRequest
+	err := lh.codec.Unmarshal(payload, &req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := lh.Handle(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return lh.codec.Marshal(resp)
+}
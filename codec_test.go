@@ -0,0 +1,154 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+type countingCodec struct {
+	marshalled   int
+	unmarshalled int
+}
+
+func (c *countingCodec) Marshal(v any) ([]byte, error) {
+	c.marshalled++
+	return json.Marshal(v)
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v any) error {
+	c.unmarshalled++
+	return json.Unmarshal(data, v)
+}
+
+func TestJSONCodec(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		io.Copy(w, r.Body)
+	})
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{
+			name:    "text bodies",
+			payload: `{"rawPath":"/","headers":{"content-type":"text/html"},"body":"<p>Hello</p>","requestContext":{"http":{"method":"POST"}}}`,
+		},
+		{
+			name:    "binary bodies",
+			payload: `{"rawPath":"/","headers":{"content-type":"image/png"},"body":"iVBORw==","isBase64Encoded":true,"requestContext":{"http":{"method":"POST"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			codec := &countingCodec{}
+			expected, err := NewLambdaHandler(handler).Invoke(context.Background(), []byte(tt.payload))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Act.
+			actual, err := NewLambdaHandler(handler, WithJSONCodec(codec)).Invoke(context.Background(), []byte(tt.payload))
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if codec.marshalled != 1 || codec.unmarshalled != 1 {
+				t.Errorf("expected the codec to be used once for each event, got %d marshal and %d unmarshal calls", codec.marshalled, codec.unmarshalled)
+			}
+			if diff := cmp.Diff(string(expected), string(actual)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+	t.Run("unmarshal errors are returned", func(t *testing.T) {
+		// Arrange.
+		lh := NewLambdaHandler(handler, WithJSONCodec(&countingCodec{}))
+
+		// Act.
+		_, err := lh.Invoke(context.Background(), []byte("{"))
+
+		// Assert.
+		var syntaxErr *json.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("expected syntax error, got %v", err)
+		}
+	})
+}
+
+func TestDefaultJSONCodec(t *testing.T) {
+	t.Run("responses are marshalled the same as encoding/json", func(t *testing.T) {
+		// Arrange.
+		resp := events.APIGatewayV2HTTPResponse{
+			StatusCode: http.StatusOK,
+			Headers:    map[string]string{"Content-Type": "text/html"},
+			Body:       "<p>Hello</p>",
+		}
+		expected, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatalf("failed to marshal response: %v", err)
+		}
+
+		// Act.
+		actual, err := DefaultJSONCodec{}.Marshal(&resp)
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(string(expected), string(actual)); diff != "" {
+			t.Error(diff)
+		}
+	})
+	t.Run("other types use encoding/json", func(t *testing.T) {
+		// Arrange.
+		var actual map[string]string
+
+		// Act.
+		err := DefaultJSONCodec{}.Unmarshal([]byte(`{"body":"a"}`), &actual)
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(map[string]string{"body": "a"}, actual); diff != "" {
+			t.Error(diff)
+		}
+	})
+}
+
+func FuzzDefaultJSONCodec(f *testing.F) {
+	f.Add(200, "Content-Type", "text/plain", "Hello, World", false, "a=b", "X-Multi", "1")
+	f.Add(404, "X-\"Quoted\"", "<a href=\"/\">&</a>", "\"line 1\"\n\tline 2\\ é \xff", false, "", "", "")
+	f.Add(200, "Content-Type", "image/png", "iVBORw==", true, "c=d; Path=/", "X-Empty", "")
+	f.Fuzz(func(t *testing.T, status int, headerKey, headerValue, body string, isBase64Encoded bool, cookie, multiKey, multiValue string) {
+		resp := events.APIGatewayV2HTTPResponse{
+			StatusCode:        status,
+			Headers:           map[string]string{headerKey: headerValue},
+			MultiValueHeaders: map[string][]string{multiKey: {multiValue}},
+			Body:              body,
+			IsBase64Encoded:   isBase64Encoded,
+			Cookies:           []string{cookie},
+		}
+		expected, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatalf("failed to marshal response: %v", err)
+		}
+		actual, err := DefaultJSONCodec{}.Marshal(resp)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(string(expected), string(actual)); diff != "" {
+			t.Error(diff)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Invocation describes the current invocation of the Lambda function within its execution environment.
+type Invocation struct {
+	// ColdStart is true for the first invocation in the execution environment.
+	ColdStart bool
+	// Count is the number of invocations in the execution environment, including the current invocation.
+	Count int64
+	// SinceStart is the time between the process starting and the invocation starting, which includes
+	// the init phase.
+	SinceStart time.Duration
+}
+
+// processStart is the time the process started, or near enough.
+var processStart = time.Now()
+
+// invocations counts the invocations in the Lambda execution environment.
+var invocations atomic.Int64
+
+func newInvocation(now time.Time) Invocation {
+	count := invocations.Add(1)
+	return Invocation{
+		ColdStart:  count == 1,
+		Count:      count,
+		SinceStart: now.Sub(processStart),
+	}
+}
+
+type invocationContextKey struct{}
+
+// GetInvocation returns details of the current invocation from the context of a request.
+func GetInvocation(ctx context.Context) (inv Invocation, ok bool) {
+	inv, ok = ctx.Value(invocationContextKey{}).(Invocation)
+	return
+}
+
+// WithInvocationHeaders adds the X-Cold-Start, X-Invocation-Count and X-Since-Start headers to every
+// response, for debugging.
+func WithInvocationHeaders() Option {
+	return func(lh *LambdaHandler) {
+		lh.invocationHeaders = true
+	}
+}
+
+func setInvocationHeaders(resp *events.APIGatewayV2HTTPResponse, inv Invocation) {
+	if resp.Headers == nil {
+		resp.Headers = make(map[string]string)
+	}
+	resp.Headers["X-Cold-Start"] = strconv.FormatBool(inv.ColdStart)
+	resp.Headers["X-Invocation-Count"] = strconv.FormatInt(inv.Count, 10)
+	resp.Headers["X-Since-Start"] = inv.SinceStart.String()
+}
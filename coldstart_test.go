@@ -0,0 +1,104 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInvocation(t *testing.T) {
+	t.Run("the first invocation is a cold start", func(t *testing.T) {
+		// Arrange.
+		invocations.Store(0)
+		var actual []Invocation
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inv, ok := GetInvocation(r.Context())
+			if !ok {
+				t.Error("expected invocation in context")
+			}
+			actual = append(actual, inv)
+		})
+		lh := NewLambdaHandler(h)
+
+		// Act.
+		for i := 0; i < 3; i++ {
+			lh.Handle(context.Background(), events.APIGatewayV2HTTPRequest{RawPath: "/"})
+		}
+
+		// Assert.
+		if len(actual) != 3 {
+			t.Fatalf("expected 3 invocations, got %d", len(actual))
+		}
+		for i, inv := range actual {
+			if inv.SinceStart <= 0 || inv.SinceStart > time.Since(processStart) {
+				t.Errorf("invocation %d: unexpected time since start %v", i, inv.SinceStart)
+			}
+			actual[i].SinceStart = 0
+		}
+		expected := []Invocation{
+			{ColdStart: true, Count: 1},
+			{ColdStart: false, Count: 2},
+			{ColdStart: false, Count: 3},
+		}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Error(diff)
+		}
+	})
+	t.Run("headers are not added by default", func(t *testing.T) {
+		// Arrange.
+		lh := NewLambdaHandler(http.NotFoundHandler())
+
+		// Act.
+		resp, err := lh.Handle(context.Background(), events.APIGatewayV2HTTPRequest{RawPath: "/"})
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, ok := resp.Headers["X-Cold-Start"]; ok {
+			t.Error("unexpected X-Cold-Start header")
+		}
+	})
+	t.Run("headers can be added to the response", func(t *testing.T) {
+		// Arrange.
+		invocations.Store(0)
+		lh := NewLambdaHandler(http.NotFoundHandler(), WithInvocationHeaders())
+
+		// Act.
+		first, err := lh.Handle(context.Background(), events.APIGatewayV2HTTPRequest{RawPath: "/"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		second, err := lh.Handle(context.Background(), events.APIGatewayV2HTTPRequest{RawPath: "/"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Assert.
+		for i, tt := range []struct {
+			resp      events.APIGatewayV2HTTPResponse
+			coldStart string
+			count     string
+		}{
+			{resp: first, coldStart: "true", count: "1"},
+			{resp: second, coldStart: "false", count: "2"},
+		} {
+			if actual := tt.resp.Headers["X-Cold-Start"]; actual != tt.coldStart {
+				t.Errorf("response %d: expected X-Cold-Start %q, got %q", i, tt.coldStart, actual)
+			}
+			if actual := tt.resp.Headers["X-Invocation-Count"]; actual != tt.count {
+				t.Errorf("response %d: expected X-Invocation-Count %q, got %q", i, tt.count, actual)
+			}
+			if _, err := time.ParseDuration(tt.resp.Headers["X-Since-Start"]); err != nil {
+				t.Errorf("response %d: invalid X-Since-Start %q: %v", i, tt.resp.Headers["X-Since-Start"], err)
+			}
+		}
+		if actual := first.Headers["Content-Type"]; actual != "text/plain; charset=utf-8" {
+			t.Errorf("expected handler headers to be kept, got Content-Type %q", actual)
+		}
+	})
+}
@@ -0,0 +1,244 @@
+// Package conformance contains a corpus of API Gateway V2 (payload format 2.0) and Lambda function URL
+// events, paired with the expected properties of the *http.Request that each event converts to, and the
+// expected response event for a given handler response.
+//
+// Run executes the corpus against any function that converts a http.Handler into a Lambda handler, so
+// it can be used to test wrappers that are built on top of, or replace, awsapigatewayv2handler.
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/a-h/awsapigatewayv2handler"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+//go:embed testdata/*.json
+var testdata embed.FS
+
+// Wrapper converts a http.Handler into a Lambda API Gateway V2 handler function, e.g.
+//
+//	func(h http.Handler) awsapigatewayv2handler.EventHandlerFunc {
+//		return awsapigatewayv2handler.NewLambdaHandler(h).Handle
+//	}
+type Wrapper func(h http.Handler) awsapigatewayv2handler.EventHandlerFunc
+
+// Case is a single conformance test.
+type Case struct {
+	// Name of the case, taken from the file name.
+	Name        string `json:"-"`
+	Description string `json:"description"`
+	// Event is the captured API Gateway event.
+	Event events.APIGatewayV2HTTPRequest `json:"event"`
+	// Request is the expected properties of the *http.Request received by the handler.
+	Request Request `json:"request"`
+	// HandlerResponse is the response written by the handler.
+	HandlerResponse HandlerResponse `json:"handlerResponse"`
+	// Response is the expected API Gateway response event.
+	Response events.APIGatewayV2HTTPResponse `json:"response"`
+}
+
+// Request contains the expected properties of a *http.Request. Nil fields are not checked, and only the
+// headers and form values that are present are checked.
+type Request struct {
+	Method        *string             `json:"method,omitempty"`
+	URL           *string             `json:"url,omitempty"`
+	Path          *string             `json:"path,omitempty"`
+	RawPath       *string             `json:"rawPath,omitempty"`
+	RawQuery      *string             `json:"rawQuery,omitempty"`
+	Host          *string             `json:"host,omitempty"`
+	RemoteAddr    *string             `json:"remoteAddr,omitempty"`
+	Headers       map[string][]string `json:"headers,omitempty"`
+	ContentLength *int64              `json:"contentLength,omitempty"`
+	Body          *string             `json:"body,omitempty"`
+	BodyBase64    *string             `json:"bodyBase64,omitempty"`
+	Form          map[string][]string `json:"form,omitempty"`
+	// Files maps multipart form field names to the expected file contents.
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// HandlerResponse is written by the handler under test.
+type HandlerResponse struct {
+	StatusCode int                 `json:"statusCode"`
+	Headers    map[string][]string `json:"headers"`
+	Body       string              `json:"body"`
+	BodyBase64 string              `json:"bodyBase64"`
+}
+
+// Cases returns the conformance test cases, sorted by name.
+func Cases() (cases []Case, err error) {
+	files, err := fs.Glob(testdata, "testdata/*.json")
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+	for _, fileName := range files {
+		data, err := testdata.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		var c Case
+		if err = json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("conformance: failed to parse %s: %w", fileName, err)
+		}
+		c.Name = strings.TrimSuffix(path.Base(fileName), ".json")
+		cases = append(cases, c)
+	}
+	return
+}
+
+// Run executes each conformance case against the wrapper as a subtest.
+func Run(t *testing.T, wrap Wrapper) {
+	cases, err := Cases()
+	if err != nil {
+		t.Fatalf("failed to load cases: %v", err)
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			for _, err := range c.Check(wrap) {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// Check runs the case against the wrapper, and returns any differences from the expected results.
+func (c Case) Check(wrap Wrapper) (errs []error) {
+	var received *receivedRequest
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		received, err = receive(r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read request: %w", err))
+		}
+		c.HandlerResponse.write(w)
+	})
+	// Marshal and unmarshal the event to ensure the wrapper can't modify the case.
+	payload, err := json.Marshal(c.Event)
+	if err != nil {
+		return append(errs, fmt.Errorf("failed to marshal event: %w", err))
+	}
+	var e events.APIGatewayV2HTTPRequest
+	if err = json.Unmarshal(payload, &e); err != nil {
+		return append(errs, fmt.Errorf("failed to unmarshal event: %w", err))
+	}
+	resp, err := wrap(h)(context.Background(), e)
+	if err != nil {
+		return append(errs, fmt.Errorf("unexpected error: %w", err))
+	}
+	if received == nil {
+		errs = append(errs, fmt.Errorf("handler was not called"))
+	} else {
+		errs = append(errs, c.Request.compare(received)...)
+	}
+	if diff := cmp.Diff(c.Response, resp); diff != "" {
+		errs = append(errs, fmt.Errorf("response (-expected +actual):\n%s", diff))
+	}
+	return errs
+}
+
+type receivedRequest struct {
+	*http.Request
+	body []byte
+}
+
+func receive(r *http.Request) (rr *receivedRequest, err error) {
+	rr = &receivedRequest{Request: r}
+	rr.body, err = io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		r.Body = io.NopCloser(bytes.NewReader(rr.body))
+		if strings.HasPrefix(contentType, "multipart/") {
+			err = r.ParseMultipartForm(1 << 20)
+		} else {
+			err = r.ParseForm()
+		}
+	}
+	return
+}
+
+func (expected Request) compare(actual *receivedRequest) (errs []error) {
+	compareString := func(name string, expected *string, actual string) {
+		if expected != nil && *expected != actual {
+			errs = append(errs, fmt.Errorf("%s: expected %q, got %q", name, *expected, actual))
+		}
+	}
+	compareString("method", expected.Method, actual.Method)
+	compareString("url", expected.URL, actual.URL.String())
+	compareString("path", expected.Path, actual.URL.Path)
+	compareString("raw path", expected.RawPath, actual.URL.RawPath)
+	compareString("raw query", expected.RawQuery, actual.URL.RawQuery)
+	compareString("host", expected.Host, actual.Host)
+	compareString("remote address", expected.RemoteAddr, actual.RemoteAddr)
+	compareString("body", expected.Body, string(actual.body))
+	compareString("base64 body", expected.BodyBase64, base64.StdEncoding.EncodeToString(actual.body))
+	if expected.ContentLength != nil && *expected.ContentLength != actual.ContentLength {
+		errs = append(errs, fmt.Errorf("content length: expected %d, got %d", *expected.ContentLength, actual.ContentLength))
+	}
+	for k, v := range expected.Headers {
+		if diff := cmp.Diff(v, actual.Header.Values(k)); diff != "" {
+			errs = append(errs, fmt.Errorf("header %q (-expected +actual):\n%s", k, diff))
+		}
+	}
+	for k, v := range expected.Form {
+		if diff := cmp.Diff(v, actual.Form[k]); diff != "" {
+			errs = append(errs, fmt.Errorf("form value %q (-expected +actual):\n%s", k, diff))
+		}
+	}
+	for k, v := range expected.Files {
+		errs = append(errs, compareFile(actual.Request, k, v)...)
+	}
+	return
+}
+
+func compareFile(r *http.Request, field, expected string) (errs []error) {
+	if r.MultipartForm == nil || len(r.MultipartForm.File[field]) == 0 {
+		return []error{fmt.Errorf("file %q: not found", field)}
+	}
+	f, err := r.MultipartForm.File[field][0].Open()
+	if err != nil {
+		return []error{fmt.Errorf("file %q: failed to open: %w", field, err)}
+	}
+	defer f.Close()
+	actual, err := io.ReadAll(f)
+	if err != nil {
+		return []error{fmt.Errorf("file %q: failed to read: %w", field, err)}
+	}
+	if string(actual) != expected {
+		return []error{fmt.Errorf("file %q: expected %q, got %q", field, expected, string(actual))}
+	}
+	return nil
+}
+
+func (hr HandlerResponse) write(w http.ResponseWriter) {
+	for k, v := range hr.Headers {
+		for _, vv := range v {
+			w.Header().Add(k, vv)
+		}
+	}
+	body := []byte(hr.Body)
+	if hr.BodyBase64 != "" {
+		body, _ = base64.StdEncoding.DecodeString(hr.BodyBase64)
+	}
+	if hr.StatusCode != 0 {
+		w.WriteHeader(hr.StatusCode)
+	}
+	w.Write(body)
+}
@@ -0,0 +1,53 @@
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/a-h/awsapigatewayv2handler"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestLambdaHandler(t *testing.T) {
+	Run(t, func(h http.Handler) awsapigatewayv2handler.EventHandlerFunc {
+		return awsapigatewayv2handler.NewLambdaHandler(h).Handle
+	})
+}
+
+func TestLambdaHandlerInvoke(t *testing.T) {
+	Run(t, func(h http.Handler) awsapigatewayv2handler.EventHandlerFunc {
+		lh := awsapigatewayv2handler.NewLambdaHandler(h)
+		return func(ctx context.Context, e events.APIGatewayV2HTTPRequest) (resp events.APIGatewayV2HTTPResponse, err error) {
+			payload, err := json.Marshal(e)
+			if err != nil {
+				return resp, err
+			}
+			data, err := lh.Invoke(ctx, payload)
+			if err != nil {
+				return resp, err
+			}
+			err = json.Unmarshal(data, &resp)
+			return resp, err
+		}
+	})
+}
+
+func TestCases(t *testing.T) {
+	cases, err := Cases()
+	if err != nil {
+		t.Fatalf("failed to load cases: %v", err)
+	}
+	if len(cases) == 0 {
+		t.Fatal("expected cases to be loaded")
+	}
+	for _, c := range cases {
+		if c.Description == "" {
+			t.Errorf("%s: missing description", c.Name)
+		}
+		if c.Event.Version != "2.0" {
+			t.Errorf("%s: expected payload version 2.0, got %q", c.Name, c.Event.Version)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package awsapigatewayv2handler
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// CORSOptions configures Cross-Origin Resource Sharing (CORS).
+type CORSOptions struct {
+	// AllowedOrigins are the origins that can make cross-origin requests. An origin can be an exact match,
+	// e.g. "https://example.com", match any subdomain, e.g. "https://*.example.com", or be "*" to allow
+	// all origins.
+	AllowedOrigins []string
+	// AllowedOriginPatterns are regular expressions that match allowed origins.
+	AllowedOriginPatterns []*regexp.Regexp
+	// AllowedMethods defaults to GET, HEAD and POST.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers that can be used, in addition to the CORS-safelisted request
+	// headers. Use "*" to allow all headers.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers that the browser can read, in addition to the
+	// CORS-safelisted response headers.
+	ExposedHeaders []string
+	// AllowCredentials allows cookies and authorization headers to be sent.
+	AllowCredentials bool
+	// MaxAge is how long the browser can cache the result of a preflight request.
+	MaxAge time.Duration
+}
+
+// WithCORS answers CORS preflight requests directly from the event, without calling the handler, and
+// adds the Access-Control-* headers to the handler's responses to allowed origins.
+//
+// If the API Gateway HTTP API has a CORS configuration, API Gateway answers preflight requests itself,
+// and this option isn't required.
+func WithCORS(opts CORSOptions) Option {
+	return func(lh *LambdaHandler) {
+		if len(opts.AllowedMethods) == 0 {
+			opts.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+		}
+		lh.cors = &opts
+	}
+}
+
+func isPreflight(e events.APIGatewayV2HTTPRequest) bool {
+	return e.RequestContext.HTTP.Method == http.MethodOptions &&
+		getHeader(e.Headers, "origin") != "" &&
+		getHeader(e.Headers, "access-control-request-method") != ""
+}
+
+// preflight returns a response to a preflight request. If the request isn't allowed, the CORS headers are
+// omitted, so that the browser rejects it.
+func (c *CORSOptions) preflight(e events.APIGatewayV2HTTPRequest) (resp events.APIGatewayV2HTTPResponse) {
+	resp.StatusCode = http.StatusNoContent
+	resp.Headers = map[string]string{
+		"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+	}
+	origin := getHeader(e.Headers, "origin")
+	if !c.isOriginAllowed(origin) || !containsFold(c.AllowedMethods, getHeader(e.Headers, "access-control-request-method")) {
+		return
+	}
+	var requestedHeaders []string
+	for _, h := range strings.Split(getHeader(e.Headers, "access-control-request-headers"), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			requestedHeaders = append(requestedHeaders, h)
+		}
+	}
+	if !containsFold(c.AllowedHeaders, "*") {
+		for _, h := range requestedHeaders {
+			if !containsFold(c.AllowedHeaders, h) {
+				return
+			}
+		}
+	}
+	resp.Headers["Access-Control-Allow-Origin"] = c.allowOrigin(origin)
+	resp.Headers["Access-Control-Allow-Methods"] = strings.Join(c.AllowedMethods, ", ")
+	if len(requestedHeaders) > 0 {
+		resp.Headers["Access-Control-Allow-Headers"] = strings.Join(requestedHeaders, ", ")
+	}
+	if c.AllowCredentials {
+		resp.Headers["Access-Control-Allow-Credentials"] = "true"
+	}
+	if c.MaxAge > 0 {
+		resp.Headers["Access-Control-Max-Age"] = strconv.Itoa(int(c.MaxAge.Seconds()))
+	}
+	return
+}
+
+// setHeaders adds CORS headers to the response, unless the handler has already set them.
+func (c *CORSOptions) setHeaders(e events.APIGatewayV2HTTPRequest, resp *events.APIGatewayV2HTTPResponse) {
+	if resp.Headers == nil {
+		resp.Headers = make(map[string]string)
+	}
+	if _, ok := resp.Headers["Access-Control-Allow-Origin"]; ok {
+		return
+	}
+	if vary := resp.Headers["Vary"]; vary == "" {
+		resp.Headers["Vary"] = "Origin"
+	} else if !varies(vary, "Origin") {
+		resp.Headers["Vary"] += ", Origin"
+	}
+	origin := getHeader(e.Headers, "origin")
+	if origin == "" || !c.isOriginAllowed(origin) {
+		return
+	}
+	resp.Headers["Access-Control-Allow-Origin"] = c.allowOrigin(origin)
+	if c.AllowCredentials {
+		resp.Headers["Access-Control-Allow-Credentials"] = "true"
+	}
+	if len(c.ExposedHeaders) > 0 {
+		resp.Headers["Access-Control-Expose-Headers"] = strings.Join(c.ExposedHeaders, ", ")
+	}
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin header. Browsers don't send credentials
+// to a wildcard origin, so the origin is returned instead.
+func (c *CORSOptions) allowOrigin(origin string) string {
+	if containsFold(c.AllowedOrigins, "*") && !c.AllowCredentials {
+		return "*"
+	}
+	return origin
+}
+
+func (c *CORSOptions) isOriginAllowed(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok {
+			if len(origin) > len(prefix)+len(suffix) && hasPrefixFold(origin, prefix) && hasSuffixFold(origin, suffix) {
+				return true
+			}
+		}
+	}
+	for _, re := range c.AllowedOriginPatterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// getHeader returns the value of a header from an API Gateway event. API Gateway lowercases header names
+// in V2 events, but events created by other tools may not.
+func getHeader(headers map[string]string, name string) string {
+	if v, ok := headers[name]; ok {
+		return v
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// varies returns true if the Vary header value lists the header, or "*".
+func varies(vary, header string) bool {
+	for _, v := range strings.Split(vary, ",") {
+		if v = strings.TrimSpace(v); v == "*" || strings.EqualFold(v, header) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func hasSuffixFold(s, suffix string) bool {
+	return len(s) >= len(suffix) && strings.EqualFold(s[len(s)-len(suffix):], suffix)
+}
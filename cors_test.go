@@ -0,0 +1,266 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCORS(t *testing.T) {
+	preflight := func(origin, method, headers string) events.APIGatewayV2HTTPRequest {
+		e := events.APIGatewayV2HTTPRequest{
+			RawPath: "/orders",
+			Headers: map[string]string{
+				"origin":                        origin,
+				"access-control-request-method": method,
+			},
+		}
+		if headers != "" {
+			e.Headers["access-control-request-headers"] = headers
+		}
+		e.RequestContext.HTTP.Method = http.MethodOptions
+		return e
+	}
+	request := func(method, origin string) events.APIGatewayV2HTTPRequest {
+		e := events.APIGatewayV2HTTPRequest{
+			RawPath: "/orders",
+			Headers: map[string]string{},
+		}
+		if origin != "" {
+			e.Headers["origin"] = origin
+		}
+		e.RequestContext.HTTP.Method = method
+		return e
+	}
+	opts := CORSOptions{
+		AllowedOrigins:        []string{"https://example.com", "https://*.example.net"},
+		AllowedOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`^https://pr-\d+\.preview\.example\.org$`)},
+		AllowedMethods:        []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders:        []string{"Content-Type", "Authorization"},
+		ExposedHeaders:        []string{"ETag"},
+		AllowCredentials:      true,
+		MaxAge:                10 * time.Minute,
+	}
+	tests := []struct {
+		name                  string
+		opts                  CORSOptions
+		event                 events.APIGatewayV2HTTPRequest
+		handlerHeaders        map[string]string
+		expectedHandlerCalled bool
+		expectedStatus        int
+		expectedHeaders       map[string]string
+	}{
+		{
+			name:           "preflight requests are answered without calling the handler",
+			opts:           opts,
+			event:          preflight("https://example.com", "PUT", "content-type, authorization"),
+			expectedStatus: http.StatusNoContent,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Methods":     "GET, PUT",
+				"Access-Control-Allow-Headers":     "content-type, authorization",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+				"Vary":                             "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			},
+		},
+		{
+			name:           "preflight requests from wildcard subdomains are allowed",
+			opts:           opts,
+			event:          preflight("https://app.example.net", "GET", ""),
+			expectedStatus: http.StatusNoContent,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.net",
+				"Access-Control-Allow-Methods":     "GET, PUT",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+				"Vary":                             "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			},
+		},
+		{
+			name:           "preflight requests from origins that match a pattern are allowed",
+			opts:           opts,
+			event:          preflight("https://pr-123.preview.example.org", "GET", ""),
+			expectedStatus: http.StatusNoContent,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://pr-123.preview.example.org",
+				"Access-Control-Allow-Methods":     "GET, PUT",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+				"Vary":                             "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			},
+		},
+		{
+			name:           "preflight requests from other origins get no CORS headers",
+			opts:           opts,
+			event:          preflight("https://example.net.evil.com", "GET", ""),
+			expectedStatus: http.StatusNoContent,
+			expectedHeaders: map[string]string{
+				"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			},
+		},
+		{
+			name:           "preflight requests for other methods get no CORS headers",
+			opts:           opts,
+			event:          preflight("https://example.com", "DELETE", ""),
+			expectedStatus: http.StatusNoContent,
+			expectedHeaders: map[string]string{
+				"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			},
+		},
+		{
+			name:           "preflight requests for other headers get no CORS headers",
+			opts:           opts,
+			event:          preflight("https://example.com", "GET", "X-Custom"),
+			expectedStatus: http.StatusNoContent,
+			expectedHeaders: map[string]string{
+				"Vary": "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			},
+		},
+		{
+			name: "all headers can be allowed",
+			opts: CORSOptions{
+				AllowedOrigins: []string{"*"},
+				AllowedHeaders: []string{"*"},
+			},
+			event:          preflight("https://example.com", "POST", "X-Custom"),
+			expectedStatus: http.StatusNoContent,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Methods": "GET, HEAD, POST",
+				"Access-Control-Allow-Headers": "X-Custom",
+				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			},
+		},
+		{
+			name:                  "OPTIONS requests that aren't preflight requests are passed to the handler",
+			opts:                  opts,
+			event:                 request(http.MethodOptions, "https://example.com"),
+			expectedHandlerCalled: true,
+			expectedStatus:        http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "ETag",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:                  "responses to allowed origins have CORS headers",
+			opts:                  opts,
+			event:                 request(http.MethodGet, "https://example.com"),
+			handlerHeaders:        map[string]string{"Vary": "Accept-Encoding"},
+			expectedHandlerCalled: true,
+			expectedStatus:        http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "ETag",
+				"Vary":                             "Accept-Encoding, Origin",
+			},
+		},
+		{
+			name:                  "origin isn't added to Vary twice",
+			opts:                  opts,
+			event:                 request(http.MethodGet, "https://example.com"),
+			handlerHeaders:        map[string]string{"Vary": "Accept-Encoding, origin"},
+			expectedHandlerCalled: true,
+			expectedStatus:        http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "ETag",
+				"Vary":                             "Accept-Encoding, origin",
+			},
+		},
+		{
+			name: "the origin is wildcarded if credentials aren't allowed",
+			opts: CORSOptions{
+				AllowedOrigins: []string{"*"},
+			},
+			event:                 request(http.MethodGet, "https://example.com"),
+			expectedHandlerCalled: true,
+			expectedStatus:        http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "*",
+				"Vary":                        "Origin",
+			},
+		},
+		{
+			name:                  "responses to other origins don't have CORS headers",
+			opts:                  opts,
+			event:                 request(http.MethodGet, "https://evil.com"),
+			expectedHandlerCalled: true,
+			expectedStatus:        http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			name:                  "responses to same origin requests don't have CORS headers",
+			opts:                  opts,
+			event:                 request(http.MethodGet, ""),
+			expectedHandlerCalled: true,
+			expectedStatus:        http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Vary": "Origin",
+			},
+		},
+		{
+			name:  "CORS headers set by the handler are not modified",
+			opts:  opts,
+			event: request(http.MethodGet, "https://example.com"),
+			handlerHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "https://other.example.com",
+			},
+			expectedHandlerCalled: true,
+			expectedStatus:        http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "https://other.example.com",
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			var handlerCalled bool
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerCalled = true
+				for k, v := range tt.handlerHeaders {
+					w.Header().Set(k, v)
+				}
+			})
+			lh := NewLambdaHandler(h, WithCORS(tt.opts))
+
+			// Act.
+			resp, err := lh.Handle(context.Background(), tt.event)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if handlerCalled != tt.expectedHandlerCalled {
+				t.Errorf("expected handler called %v, got %v", tt.expectedHandlerCalled, handlerCalled)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			actualHeaders := map[string]string{}
+			for k, v := range resp.Headers {
+				if strings.HasPrefix(k, "Access-Control-") || k == "Vary" {
+					actualHeaders[k] = v
+				}
+			}
+			if diff := cmp.Diff(tt.expectedHeaders, actualHeaders); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package awsapigatewayv2handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// decodeRequest unmarshals an API Gateway event. Large bodies dominate the cost of decoding, so the body
+// is extracted without being scanned by encoding/json, and the rest of the event is unmarshalled as usual.
+//
+// Base64 bodies are validated when they're decoded, so a base64 body containing characters that aren't
+// valid in a JSON string results in a bad request, rather than an error.
+func decodeRequest(payload []byte, e *events.APIGatewayV2HTTPRequest) error {
+	start, end, ok := findBody(payload)
+	if !ok {
+		return json.Unmarshal(payload, e)
+	}
+	rest := make([]byte, 0, len(payload)-(end-start)+2)
+	rest = append(rest, payload[:start]...)
+	rest = append(rest, `""`...)
+	rest = append(rest, payload[end:]...)
+	if err := json.Unmarshal(rest, e); err != nil {
+		return err
+	}
+	body := payload[start+1 : end-1]
+	if !e.IsBase64Encoded && !isPlainASCII(body) {
+		*e = events.APIGatewayV2HTTPRequest{}
+		return json.Unmarshal(payload, e)
+	}
+	e.Body = string(body)
+	return nil
+}
+
+// findBody returns the position of the top-level body string, including its quotes. ok is false if the
+// body isn't present, or contains escapes, in which case encoding/json is needed to decode it.
+func findBody(payload []byte) (start, end int, ok bool) {
+	i := skipSpace(payload, 0)
+	if i >= len(payload) || payload[i] != '{' {
+		return 0, 0, false
+	}
+	i++
+	for {
+		i = skipSpace(payload, i)
+		if i >= len(payload) {
+			return 0, 0, false
+		}
+		if payload[i] == '}' {
+			break
+		}
+		if payload[i] != '"' {
+			return 0, 0, false
+		}
+		keyEnd := bytes.IndexByte(payload[i+1:], '"')
+		if keyEnd < 0 {
+			return 0, 0, false
+		}
+		key := payload[i+1 : i+1+keyEnd]
+		if bytes.IndexByte(key, '\\') >= 0 {
+			// Escaped keys could match the body field.
+			return 0, 0, false
+		}
+		i = skipSpace(payload, i+keyEnd+2)
+		if i >= len(payload) || payload[i] != ':' {
+			return 0, 0, false
+		}
+		i = skipSpace(payload, i+1)
+		switch {
+		case string(key) == "body":
+			if i >= len(payload) || payload[i] != '"' {
+				return 0, 0, false
+			}
+			n := bytes.IndexByte(payload[i+1:], '"')
+			if n < 0 || bytes.IndexByte(payload[i+1:i+1+n], '\\') >= 0 {
+				return 0, 0, false
+			}
+			// If the field is repeated, encoding/json uses the last value.
+			start, end = i, i+n+2
+			i = end
+		case bytes.EqualFold(key, []byte("body")):
+			// encoding/json matches field names case-insensitively.
+			return 0, 0, false
+		default:
+			if i = skipValue(payload, i); i < 0 {
+				return 0, 0, false
+			}
+		}
+		i = skipSpace(payload, i)
+		if i >= len(payload) {
+			return 0, 0, false
+		}
+		if payload[i] == ',' {
+			i++
+			continue
+		}
+		if payload[i] != '}' {
+			return 0, 0, false
+		}
+		break
+	}
+	return start, end, end > 0
+}
+
+func isPlainASCII(s []byte) bool {
+	for _, c := range s {
+		if c < 0x20 || c > 0x7e || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+func skipSpace(s []byte, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\r' || s[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// skipValue returns the position after the JSON value at i, or -1 if the value isn't terminated. The value
+// isn't validated, since encoding/json validates the rest of the event.
+func skipValue(s []byte, i int) int {
+	depth := 0
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(s) {
+				return -1
+			}
+			if depth == 0 {
+				return i + 1
+			}
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				return i
+			}
+			if depth--; depth == 0 {
+				return i + 1
+			}
+		case ',', ' ', '\t', '\r', '\n':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	if depth == 0 {
+		return i
+	}
+	return -1
+}
+
+// encodeResponse marshals an API Gateway response, with the binary body, if there is one, base64 encoded
+// as the response body. The output is the same as json.Marshal, but the body is written once into a buffer
+// of the right size, instead of being base64 encoded, then escaped into a growing buffer and copied.
+func encodeResponse(resp events.APIGatewayV2HTTPResponse, binary []byte) []byte {
+	size := 128 + len(resp.Body) + base64.StdEncoding.EncodedLen(len(binary))
+	for k, v := range resp.Headers {
+		size += len(k) + len(v) + 6
+	}
+	for _, c := range resp.Cookies {
+		size += len(c) + 3
+	}
+	b := make([]byte, 0, size)
+	b = append(b, `{"statusCode":`...)
+	b = strconv.AppendInt(b, int64(resp.StatusCode), 10)
+	b = append(b, `,"headers":`...)
+	b = appendStringMap(b, resp.Headers)
+	b = append(b, `,"multiValueHeaders":`...)
+	if resp.MultiValueHeaders == nil {
+		b = append(b, "null"...)
+	} else {
+		b = append(b, '{')
+		for i, k := range sortedKeys(resp.MultiValueHeaders) {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendString(b, k)
+			b = append(b, ':')
+			b = appendStrings(b, resp.MultiValueHeaders[k])
+		}
+		b = append(b, '}')
+	}
+	b = append(b, `,"body":`...)
+	if binary != nil {
+		b = append(b, '"')
+		// The size estimate doesn't allow for escaped headers, so there may not be enough space left.
+		b = slices.Grow(b, base64.StdEncoding.EncodedLen(len(binary))+1)
+		n := len(b)
+		b = b[:n+base64.StdEncoding.EncodedLen(len(binary))]
+		base64.StdEncoding.Encode(b[n:], binary)
+		b = append(b, '"')
+	} else {
+		b = appendString(b, resp.Body)
+	}
+	if resp.IsBase64Encoded {
+		b = append(b, `,"isBase64Encoded":true`...)
+	}
+	b = append(b, `,"cookies":`...)
+	b = appendStrings(b, resp.Cookies)
+	return append(b, '}')
+}
+
+func appendStringMap(b []byte, m map[string]string) []byte {
+	if m == nil {
+		return append(b, "null"...)
+	}
+	b = append(b, '{')
+	for i, k := range sortedKeys(m) {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendString(b, k)
+		b = append(b, ':')
+		b = appendString(b, m[k])
+	}
+	return append(b, '}')
+}
+
+func appendStrings(b []byte, s []string) []byte {
+	if s == nil {
+		return append(b, "null"...)
+	}
+	b = append(b, '[')
+	for i, v := range s {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendString(b, v)
+	}
+	return append(b, ']')
+}
+
+// appendString appends a JSON string. Strings that need escaping are rare in responses, and base64 bodies
+// never need it, so they're left to encoding/json, which escapes HTML characters and invalid UTF-8.
+func appendString(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if !safeJSON[s[i]] {
+			escaped, _ := json.Marshal(s)
+			return append(b, escaped...)
+		}
+	}
+	b = append(b, '"')
+	b = append(b, s...)
+	return append(b, '"')
+}
+
+// safeJSON is the set of bytes that encoding/json writes to strings without escaping.
+var safeJSON = func() (safe [256]bool) {
+	for c := 0x20; c <= 0x7e; c++ {
+		safe[c] = c != '"' && c != '\\' && c != '<' && c != '>' && c != '&'
+	}
+	return safe
+}()
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
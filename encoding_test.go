@@ -0,0 +1,255 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecodeRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{
+			name:    "events without a body",
+			payload: `{"rawPath":"/","requestContext":{"http":{"method":"GET"}}}`,
+		},
+		{
+			name:    "base64 bodies",
+			payload: `{"rawPath":"/","body":"SGVsbG8=","isBase64Encoded":true}`,
+		},
+		{
+			name:    "text bodies",
+			payload: `{"rawPath":"/","body":"Hello, World"}`,
+		},
+		{
+			name:    "text bodies with escapes",
+			payload: `{"rawPath":"/","body":"\"Hello\"\né"}`,
+		},
+		{
+			name:    "text bodies with unicode",
+			payload: `{"rawPath":"/","body":"héllo"}`,
+		},
+		{
+			name:    "whitespace",
+			payload: " {\n\t\"rawPath\" : \"/\" ,\n\t\"body\" : \"SGVsbG8=\" ,\n\t\"isBase64Encoded\" : true\n}\n",
+		},
+		{
+			name:    "fields named body in nested objects",
+			payload: `{"headers":{"body":"a"},"requestContext":{"authorizer":{"lambda":{"body":["}",{"body":"]"}]}}},"body":"b"}`,
+		},
+		{
+			name:    "repeated fields use the last value",
+			payload: `{"body":"a","body":"b"}`,
+		},
+		{
+			name:    "fields are matched case-insensitively",
+			payload: `{"body":"a","Body":"b"}`,
+		},
+		{
+			name:    "escaped field names",
+			payload: `{"body":"a","bod\u0079":"b"}`,
+		},
+		{
+			name:    "null bodies",
+			payload: `{"body":null}`,
+		},
+		{
+			name:    "invalid JSON",
+			payload: `{"body":"a",}`,
+		},
+		{
+			name:    "invalid JSON after the body",
+			payload: `{"body":"a","rawPath":}`,
+		},
+		{
+			name:    "truncated JSON",
+			payload: `{"body":"a`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			var expected events.APIGatewayV2HTTPRequest
+			expectedErr := json.Unmarshal([]byte(tt.payload), &expected)
+
+			// Act.
+			var actual events.APIGatewayV2HTTPRequest
+			err := decodeRequest([]byte(tt.payload), &actual)
+
+			// Assert.
+			if (err != nil) != (expectedErr != nil) {
+				t.Fatalf("expected error %v, got %v", expectedErr, err)
+			}
+			if diff := cmp.Diff(expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestEncodeResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		resp events.APIGatewayV2HTTPResponse
+	}{
+		{
+			name: "empty responses",
+		},
+		{
+			name: "text responses",
+			resp: events.APIGatewayV2HTTPResponse{
+				StatusCode: http.StatusOK,
+				Headers:    map[string]string{"Content-Type": "text/plain", "Content-Length": "12", "X-Empty": ""},
+				Body:       "Hello, World",
+				Cookies:    []string{"a=b", "c=d; Path=/"},
+			},
+		},
+		{
+			name: "strings that need escaping",
+			resp: events.APIGatewayV2HTTPResponse{
+				StatusCode: http.StatusOK,
+				Headers:    map[string]string{"X-\"Quoted\"": "<a href=\"/\">&</a>"},
+				Body:       "\"line 1\"\n\tline 2\\ é   \xff",
+			},
+		},
+		{
+			name: "multi-value headers",
+			resp: events.APIGatewayV2HTTPResponse{
+				StatusCode:        http.StatusOK,
+				MultiValueHeaders: map[string][]string{"X-B": {"1", "2"}, "X-A": nil, "X-C": {}},
+			},
+		},
+		{
+			name: "base64 responses",
+			resp: events.APIGatewayV2HTTPResponse{
+				StatusCode:      http.StatusOK,
+				Headers:         map[string]string{},
+				Body:            "SGVsbG8=",
+				IsBase64Encoded: true,
+				Cookies:         []string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			expected, err := json.Marshal(tt.resp)
+			if err != nil {
+				t.Fatalf("failed to marshal response: %v", err)
+			}
+
+			// Act.
+			actual := encodeResponse(tt.resp, nil)
+
+			// Assert.
+			if diff := cmp.Diff(string(expected), string(actual)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+	t.Run("binary bodies are base64 encoded", func(t *testing.T) {
+		// Arrange.
+		binary := []byte{0, 1, 2, 3, 0xff}
+		resp := events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK, IsBase64Encoded: true}
+		encoded := resp
+		encoded.Body = base64.StdEncoding.EncodeToString(binary)
+		expected, err := json.Marshal(encoded)
+		if err != nil {
+			t.Fatalf("failed to marshal response: %v", err)
+		}
+
+		// Act.
+		actual := encodeResponse(resp, binary)
+
+		// Assert.
+		if diff := cmp.Diff(string(expected), string(actual)); diff != "" {
+			t.Error(diff)
+		}
+	})
+}
+
+func TestInvokeBinaryResponse(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte{0x89, 'P', 'N', 'G'})
+	})
+	payload := []byte(`{"rawPath":"/","requestContext":{"http":{"method":"GET"}}}`)
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{
+			name: "without after response hooks",
+		},
+		{
+			name: "with after response hooks",
+			opts: []Option{WithAfterResponse(func(ctx context.Context, e events.APIGatewayV2HTTPRequest, resp *events.APIGatewayV2HTTPResponse) error {
+				return nil
+			})},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			lh := NewLambdaHandler(handler, tt.opts...)
+			var e events.APIGatewayV2HTTPRequest
+			if err := json.Unmarshal(payload, &e); err != nil {
+				t.Fatalf("failed to unmarshal request: %v", err)
+			}
+			resp, err := lh.Handle(context.Background(), e)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected, err := json.Marshal(resp)
+			if err != nil {
+				t.Fatalf("failed to marshal response: %v", err)
+			}
+
+			// Act.
+			actual, err := lh.Invoke(context.Background(), payload)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(string(expected), string(actual)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func FuzzDecodeRequest(f *testing.F) {
+	f.Add([]byte(`{"rawPath":"/path","body":"MTIzNDU=","isBase64Encoded":true,"requestContext":{"http":{"method":"POST"}}}`))
+	f.Add([]byte(`{"headers":{"body":"a"},"body":"b","Body":"c"}`))
+	f.Add([]byte(`{"body":"a\"b","cookies":["a=b"]}`))
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		var expected events.APIGatewayV2HTTPRequest
+		expectedErr := json.Unmarshal(payload, &expected)
+		var actual events.APIGatewayV2HTTPRequest
+		err := decodeRequest(payload, &actual)
+		if err != nil && expectedErr == nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err == nil && expectedErr != nil && !actual.IsBase64Encoded {
+			t.Fatalf("expected error %v", expectedErr)
+		}
+		if err != nil || expectedErr != nil || (actual.IsBase64Encoded && !isPlainASCII([]byte(actual.Body))) {
+			// Invalid base64 bodies are rejected when they're decoded.
+			return
+		}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Error(diff)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// RequestError is returned when an API Gateway event can't be converted to a HTTP request, e.g. because
+// the body isn't valid base64, or the path or method are invalid.
+type RequestError struct {
+	// Field of the event that couldn't be converted, e.g. "body", "method" or "path".
+	Field string
+	Err   error
+}
+
+func (e *RequestError) Error() string {
+	return "invalid request " + e.Field + ": " + e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// RequestErrorHandlerFunc returns the response for an event that couldn't be converted to a HTTP request.
+// If it returns an error, the error is returned from the Lambda function instead, which API Gateway
+// renders as a 500 Internal Server Error.
+type RequestErrorHandlerFunc func(ctx context.Context, e events.APIGatewayV2HTTPRequest, err *RequestError) (events.APIGatewayV2HTTPResponse, error)
+
+// WithRequestErrorHandler sets the function used to respond to events that can't be converted to HTTP
+// requests. By default, DefaultRequestErrorHandler is used.
+func WithRequestErrorHandler(f RequestErrorHandlerFunc) Option {
+	return func(lh *LambdaHandler) {
+		lh.requestErrorHandler = f
+	}
+}
+
+// DefaultRequestErrorHandler responds with a 400 Bad Request status code, and a RFC 7807 problem details
+// JSON body.
+func DefaultRequestErrorHandler(ctx context.Context, e events.APIGatewayV2HTTPRequest, err *RequestError) (events.APIGatewayV2HTTPResponse, error) {
+	body, _ := json.Marshal(problemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusBadRequest),
+		Status: http.StatusBadRequest,
+		Detail: err.Error(),
+	})
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusBadRequest,
+		Headers: map[string]string{
+			"Content-Type": "application/problem+json",
+		},
+		Body: string(body),
+	}, nil
+}
+
+type problemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func writeProblemDetails(w http.ResponseWriter, status int, detail string) {
+	body, _ := json.Marshal(problemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func (lh LambdaHandler) handleRequestError(ctx context.Context, e events.APIGatewayV2HTTPRequest, err error) (events.APIGatewayV2HTTPResponse, error) {
+	var re *RequestError
+	if !errors.As(err, &re) {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+	if lh.requestErrorHandler == nil {
+		return DefaultRequestErrorHandler(ctx, e, re)
+	}
+	return lh.requestErrorHandler(ctx, e, re)
+}
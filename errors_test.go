@@ -0,0 +1,106 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+var invalidBodyEvent = events.APIGatewayV2HTTPRequest{
+	RawPath:         "/path",
+	Body:            "not base64!",
+	IsBase64Encoded: true,
+	RequestContext: events.APIGatewayV2HTTPRequestContext{
+		HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+			Method: http.MethodPost,
+		},
+	},
+}
+
+func TestRequestErrors(t *testing.T) {
+	t.Run("by default, a problem details response is returned", func(t *testing.T) {
+		// Arrange.
+		lh := NewLambdaHandler(http.NotFoundHandler())
+
+		// Act.
+		resp, err := lh.Handle(context.Background(), invalidBodyEvent)
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", resp.StatusCode)
+		}
+		if ct := resp.Headers["Content-Type"]; ct != "application/problem+json" {
+			t.Errorf("expected problem+json content type, got %q", ct)
+		}
+		var pd problemDetails
+		if err = json.Unmarshal([]byte(resp.Body), &pd); err != nil {
+			t.Fatalf("failed to unmarshal body: %v", err)
+		}
+		expected := problemDetails{
+			Type:   "about:blank",
+			Title:  "Bad Request",
+			Status: http.StatusBadRequest,
+			Detail: "invalid request body: illegal base64 data at input byte 3",
+		}
+		if diff := cmp.Diff(expected, pd); diff != "" {
+			t.Error(diff)
+		}
+	})
+	t.Run("the response can be customised", func(t *testing.T) {
+		// Arrange.
+		var actualField string
+		lh := NewLambdaHandler(http.NotFoundHandler(), WithRequestErrorHandler(func(ctx context.Context, e events.APIGatewayV2HTTPRequest, err *RequestError) (events.APIGatewayV2HTTPResponse, error) {
+			actualField = err.Field
+			return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusUnprocessableEntity}, nil
+		}))
+
+		// Act.
+		resp, err := lh.Handle(context.Background(), invalidBodyEvent)
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("expected status 422, got %d", resp.StatusCode)
+		}
+		if actualField != "body" {
+			t.Errorf("expected field body, got %q", actualField)
+		}
+	})
+	t.Run("the error handler can return a Lambda error", func(t *testing.T) {
+		// Arrange.
+		expectedErr := errors.New("failed")
+		lh := NewLambdaHandler(http.NotFoundHandler(), WithRequestErrorHandler(func(ctx context.Context, e events.APIGatewayV2HTTPRequest, err *RequestError) (events.APIGatewayV2HTTPResponse, error) {
+			return events.APIGatewayV2HTTPResponse{}, expectedErr
+		}))
+
+		// Act.
+		_, err := lh.Handle(context.Background(), invalidBodyEvent)
+
+		// Assert.
+		if !errors.Is(err, expectedErr) {
+			t.Errorf("expected error %v, got %v", expectedErr, err)
+		}
+	})
+	t.Run("invalid JSON payloads are returned as Lambda errors", func(t *testing.T) {
+		// Arrange.
+		lh := NewLambdaHandler(http.NotFoundHandler())
+
+		// Act.
+		_, err := lh.Invoke(context.Background(), []byte("{"))
+
+		// Assert.
+		if err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
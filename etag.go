@@ -0,0 +1,82 @@
+package awsapigatewayv2handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// WithETags adds a strong ETag, a hash of the body, to successful GET responses that don't already have one,
+// and answers requests with a matching If-None-Match header, or an If-Modified-Since header that's not before
+// the Last-Modified header, with 304 Not Modified and no body.
+func WithETags() Option {
+	return func(lh *LambdaHandler) {
+		lh.etags = true
+	}
+}
+
+func conditionalResponse(r *http.Request, rec *httptest.ResponseRecorder) *httptest.ResponseRecorder {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return rec
+	}
+	result := rec.Result()
+	if result.StatusCode != http.StatusOK || len(result.Trailer) > 0 {
+		return rec
+	}
+	etag := result.Header.Get("ETag")
+	if etag == "" {
+		if r.Method == http.MethodHead {
+			// The body of a HEAD response is empty, so it can't be hashed.
+			return rec
+		}
+		sum := sha256.Sum256(rec.Body.Bytes())
+		etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+	}
+	w := httptest.NewRecorder()
+	for k, v := range result.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("ETag", etag)
+	if isNotModified(r, result.Header, etag) {
+		// Remove the same headers as net/http.
+		w.Header().Del("Content-Type")
+		w.Header().Del("Content-Length")
+		w.Header().Del("Content-Encoding")
+		w.Header().Del("Last-Modified")
+		w.WriteHeader(http.StatusNotModified)
+		return w
+	}
+	w.Body = rec.Body
+	w.WriteHeader(result.StatusCode)
+	return w
+}
+
+func isNotModified(r *http.Request, header http.Header, etag string) bool {
+	// If-None-Match takes precedence over If-Modified-Since.
+	// See https://www.rfc-editor.org/rfc/rfc9110#section-13.2.2
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(ims)
+}
+
+// etagMatches uses the weak comparison required for If-None-Match.
+func etagMatches(inm, etag string) bool {
+	for _, candidate := range strings.Split(inm, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestETags(t *testing.T) {
+	const etag = `"03675ac53ff9cd1535ccc7dfcdfa2c45"`
+	const lastModified = "Wed, 21 Oct 2015 07:28:00 GMT"
+	tests := []struct {
+		name            string
+		opts            []Option
+		method          string
+		headers         map[string]string
+		handlerHeaders  map[string]string
+		handlerStatus   int
+		expectedStatus  int
+		expectedHeaders map[string]string
+		expectedBody    string
+	}{
+		{
+			name:           "ETags aren't added by default",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Content-Type": "text/plain",
+			},
+			expectedBody: "Hello, World",
+		},
+		{
+			name:           "ETags are added to GET responses",
+			opts:           []Option{WithETags()},
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Content-Type": "text/plain",
+				"Etag":         etag,
+			},
+			expectedBody: "Hello, World",
+		},
+		{
+			name:           "matching If-None-Match headers return 304 Not Modified",
+			opts:           []Option{WithETags()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-None-Match": etag},
+			expectedStatus: http.StatusNotModified,
+			expectedHeaders: map[string]string{
+				"Etag": etag,
+			},
+		},
+		{
+			name:           "If-None-Match headers use weak comparison",
+			opts:           []Option{WithETags()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-None-Match": `"abc", W/` + etag},
+			expectedStatus: http.StatusNotModified,
+			expectedHeaders: map[string]string{
+				"Etag": etag,
+			},
+		},
+		{
+			name:           "If-None-Match headers can match any ETag",
+			opts:           []Option{WithETags()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-None-Match": "*"},
+			expectedStatus: http.StatusNotModified,
+			expectedHeaders: map[string]string{
+				"Etag": etag,
+			},
+		},
+		{
+			name:           "If-None-Match headers that don't match return the body",
+			opts:           []Option{WithETags()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-None-Match": `"abc"`},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Content-Type": "text/plain",
+				"Etag":         etag,
+			},
+			expectedBody: "Hello, World",
+		},
+		{
+			name:           "ETags set by the handler are used",
+			opts:           []Option{WithETags()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-None-Match": `W/"v1"`},
+			handlerHeaders: map[string]string{"ETag": `W/"v1"`, "Cache-Control": "max-age=60"},
+			expectedStatus: http.StatusNotModified,
+			expectedHeaders: map[string]string{
+				"Cache-Control": "max-age=60",
+				"Etag":          `W/"v1"`,
+			},
+		},
+		{
+			name:           "If-Modified-Since headers that aren't before Last-Modified return 304 Not Modified",
+			opts:           []Option{WithETags()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-Modified-Since": lastModified},
+			handlerHeaders: map[string]string{"Last-Modified": lastModified},
+			expectedStatus: http.StatusNotModified,
+			expectedHeaders: map[string]string{
+				"Etag": etag,
+			},
+		},
+		{
+			name:           "If-Modified-Since headers before Last-Modified return the body",
+			opts:           []Option{WithETags()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-Modified-Since": "Tue, 20 Oct 2015 07:28:00 GMT"},
+			handlerHeaders: map[string]string{"Last-Modified": lastModified},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Content-Type":  "text/plain",
+				"Etag":          etag,
+				"Last-Modified": lastModified,
+			},
+			expectedBody: "Hello, World",
+		},
+		{
+			name:           "If-None-Match headers take precedence over If-Modified-Since",
+			opts:           []Option{WithETags()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-None-Match": `"abc"`, "If-Modified-Since": lastModified},
+			handlerHeaders: map[string]string{"Last-Modified": lastModified},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Content-Type":  "text/plain",
+				"Etag":          etag,
+				"Last-Modified": lastModified,
+			},
+			expectedBody: "Hello, World",
+		},
+		{
+			name:           "POST responses are unchanged",
+			opts:           []Option{WithETags()},
+			method:         http.MethodPost,
+			headers:        map[string]string{"If-None-Match": "*"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Content-Type": "text/plain",
+			},
+			expectedBody: "Hello, World",
+		},
+		{
+			name:           "unsuccessful responses are unchanged",
+			opts:           []Option{WithETags()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-None-Match": "*"},
+			handlerStatus:  http.StatusNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedHeaders: map[string]string{
+				"Content-Type": "text/plain",
+			},
+			expectedBody: "Hello, World",
+		},
+		{
+			name:           "ETags aren't added to HEAD responses",
+			opts:           []Option{WithETags()},
+			method:         http.MethodHead,
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Content-Type": "text/plain",
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				for k, v := range tt.handlerHeaders {
+					w.Header().Set(k, v)
+				}
+				if tt.handlerStatus != 0 {
+					w.WriteHeader(tt.handlerStatus)
+				}
+				if r.Method != http.MethodHead {
+					io.WriteString(w, "Hello, World")
+				}
+			})
+			lh := NewLambdaHandler(h, tt.opts...)
+			e := events.APIGatewayV2HTTPRequest{
+				RawPath: "/",
+				Headers: tt.headers,
+			}
+			e.RequestContext.HTTP.Method = tt.method
+
+			// Act.
+			resp, err := lh.Handle(context.Background(), e)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if diff := cmp.Diff(tt.expectedHeaders, resp.Headers); diff != "" {
+				t.Error(diff)
+			}
+			if resp.Body != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, resp.Body)
+			}
+		})
+	}
+}
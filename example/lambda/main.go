@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
@@ -14,19 +15,18 @@ import (
 	"context"
 
 	"github.com/a-h/awsapigatewayv2handler"
+	"github.com/a-h/awsapigatewayv2handler/invoke"
+	apigwotel "github.com/a-h/awsapigatewayv2handler/otel"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda/xrayconfig"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/contrib/propagators/aws/xray"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/trace"
-	"go.uber.org/zap"
 )
 
 //go:embed static
@@ -36,21 +36,13 @@ type Data struct {
 	Now time.Time `json:"now"`
 }
 
-var logger *zap.Logger
-
-func init() {
-	var err error
-	logger, err = zap.NewProduction()
-	if err != nil {
-		panic("unable to create logger: " + err.Error())
-	}
-}
-
 func main() {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	ctx := context.Background()
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
-		logger.Fatal("failed to load AWS config", zap.Error(err))
+		logger.Error("failed to load AWS config", slog.Any("error", err))
+		os.Exit(1)
 	}
 
 	// Configure Lambda functions.
@@ -58,7 +50,7 @@ func main() {
 		io.WriteString(w, "Hello")
 	}))
 	http.Handle("/dynamofail", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log := withTraceIDLogger(r.Context(), logger)
+		log := awsapigatewayv2handler.GetLogger(r.Context())
 		svc := dynamodb.NewFromConfig(cfg)
 		_, err := svc.GetItem(r.Context(), &dynamodb.GetItemInput{
 			TableName: aws.String("apigatewayv2example-table"), // Doesn't exist. Expect this to fail.
@@ -66,7 +58,7 @@ func main() {
 				"_pk": &types.AttributeValueMemberS{Value: "123"},
 			},
 		})
-		log.Error("dynamodb error", zap.Error(err))
+		log.Error("dynamodb error", slog.Any("error", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}))
 	http.Handle("/smile", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -86,24 +78,29 @@ func main() {
 	}))
 	// Serve the static directory that has been embedded into the binary.
 	// The static directory contains a mix of binary and text files, for testing.
-	http.Handle("/static/", http.FileServer(http.FS(static)))
+	staticFS, err := awsapigatewayv2handler.NewStaticFS(static, awsapigatewayv2handler.StaticFSOptions{})
+	if err != nil {
+		logger.Error("failed to read static files", slog.Any("error", err))
+		os.Exit(1)
+	}
+	http.Handle("/static/", staticFS)
 	http.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, "Index")
 	}))
 	http.Handle("/xray", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Log with the @xrayTraceId field to include log entries show up alongside X-Ray traces in the AWS console.
-		log := withTraceIDLogger(r.Context(), logger)
+		// The logger includes the @xrayTraceId field, so log entries show up alongside X-Ray traces in the AWS console.
+		log := awsapigatewayv2handler.GetLogger(r.Context())
 		// Use an instrumented HTTP client if available (it falls back to the default HTTP client).
 		client := otelhttp.DefaultClient
 		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, "https://jsonplaceholder.typicode.com/posts", nil)
 		if err != nil {
-			log.Error("failed to create request", zap.Error(err))
+			log.Error("failed to create request", slog.Any("error", err))
 			http.Error(w, "failed to create request", http.StatusInternalServerError)
 			return
 		}
 		resp, err := client.Do(req.WithContext(r.Context()))
 		if err != nil {
-			log.Error("failed to make request", zap.Error(err))
+			log.Error("failed to make request", slog.Any("error", err))
 			http.Error(w, "failed to make request", http.StatusInternalServerError)
 			return
 		}
@@ -118,33 +115,38 @@ func main() {
 		return
 	}
 
+	// Or it can be invoked with recorded events, e.g. go run main.go invoke -expected expected.json event.json
+	if len(os.Args) > 1 && os.Args[1] == "invoke" {
+		invoke.Main(http.DefaultServeMux, os.Args[2:])
+		return
+	}
+
 	// Set up telemetry.
 	tp, err := xrayconfig.NewTracerProvider(ctx)
 	if err != nil {
-		logger.Fatal("failed to create tracer provider", zap.Error(err))
+		logger.Error("failed to create tracer provider", slog.Any("error", err))
+		os.Exit(1)
 	}
-	defer func(ctx context.Context) {
-		if err := tp.Shutdown(ctx); err != nil {
-			logger.Error("failed to shut down trace provider", zap.Error(err))
-		}
-	}(ctx)
 	otel.SetTracerProvider(tp)
 	otel.SetTextMapPropagator(xray.Propagator{})
 	// Instrument AWS SDK.
 	otelaws.AppendMiddlewares(&cfg.APIOptions)
 
 	// Start Lambda function handler.
-	handler := awsapigatewayv2handler.NewLambdaHandler(http.DefaultServeMux)
-	withTelemetry := otellambda.InstrumentHandler(handler.Handle, xrayconfig.WithRecommendedOptions(tp)...)
-	lambda.Start(withTelemetry)
+	// lambda.Start never returns, so flush traces when the Lambda execution environment shuts down.
+	handler := awsapigatewayv2handler.NewLambdaHandler(http.DefaultServeMux,
+		awsapigatewayv2handler.WithAccessLog(logger, slog.LevelInfo),
+		awsapigatewayv2handler.WithOnShutdown(func(ctx context.Context) {
+			if err := tp.Shutdown(ctx); err != nil {
+				logger.Error("failed to shut down trace provider", slog.Any("error", err))
+			}
+		}))
+	if err := handler.ListenForShutdown(); err != nil {
+		logger.Error("failed to listen for shutdown", slog.Any("error", err))
+	}
+	lambda.StartHandler(apigwotel.NewHandler(handler, apigwotel.WithTracerProvider(tp), apigwotel.WithFlusher(tp)))
 
 	// If you don't need X-Ray, you can use ListenAndServe directly instead of calling lambda.StartHandler or
 	// lambda.Start yourself.
 	// awsapigatewayv2handler.ListenAndServe(http.DefaultServeMux)
 }
-
-func withTraceIDLogger(ctx context.Context, log *zap.Logger) *zap.Logger {
-	span := trace.SpanFromContext(ctx)
-	traceID := span.SpanContext().TraceID().String()
-	return log.With(zap.String("@xrayTraceId", fmt.Sprintf("1-%s-%s", traceID[0:8], traceID[8:])))
-}
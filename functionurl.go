@@ -0,0 +1,31 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// IsFunctionURL returns true if the event was sent by a Lambda function URL, rather than API Gateway.
+// Function URLs use the payload format 2.0 event, but are served from a lambda-url domain, and don't have
+// stages or route keys.
+func IsFunctionURL(e events.APIGatewayV2HTTPRequest) bool {
+	return strings.Contains(e.RequestContext.DomainName, ".lambda-url.")
+}
+
+// IsFunctionURLRequest returns true if the request in the context was sent by a Lambda function URL.
+func IsFunctionURLRequest(ctx context.Context) bool {
+	e, ok := GetEvent(ctx)
+	return ok && IsFunctionURL(e)
+}
+
+// GetIAMPrincipal returns the IAM principal that signed the request, if the function URL or API Gateway
+// route uses AWS_IAM authorization.
+func GetIAMPrincipal(ctx context.Context) (p events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription, ok bool) {
+	e, ok := GetEvent(ctx)
+	if !ok || e.RequestContext.Authorizer == nil || e.RequestContext.Authorizer.IAM == nil {
+		return p, false
+	}
+	return *e.RequestContext.Authorizer.IAM, true
+}
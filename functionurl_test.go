@@ -0,0 +1,122 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func loadConformanceEvent(t *testing.T, name string) (e events.APIGatewayV2HTTPRequest) {
+	data, err := os.ReadFile("conformance/testdata/" + name + ".json")
+	if err != nil {
+		t.Fatalf("failed to read event: %v", err)
+	}
+	var c struct {
+		Event events.APIGatewayV2HTTPRequest `json:"event"`
+	}
+	if err = json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("failed to unmarshal event: %v", err)
+	}
+	return c.Event
+}
+
+func TestIsFunctionURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{name: "function-url", expected: true},
+		{name: "function-url-iam", expected: true},
+		{name: "iam-authorizer", expected: false},
+		{name: "get-querystring", expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := IsFunctionURL(loadConformanceEvent(t, test.name)); actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFunctionURLRequests(t *testing.T) {
+	// Arrange.
+	e := loadConformanceEvent(t, "function-url-iam")
+	// Function URLs have a $default stage, but check that paths are never stripped.
+	e.RequestContext.Stage = "a6ppmxmplalwlvyl5mldi2p2oq0hpkrc"
+	e.RawPath = "/a6ppmxmplalwlvyl5mldi2p2oq0hpkrc/path"
+	var called bool
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if !IsFunctionURLRequest(r.Context()) {
+			t.Error("expected function URL request")
+		}
+		if r.Host != "a6ppmxmplalwlvyl5mldi2p2oq0hpkrc.lambda-url.us-east-2.on.aws" {
+			t.Errorf("unexpected host %q", r.Host)
+		}
+		if r.Header.Get("Host") != "" {
+			t.Errorf("expected Host header to be removed, got %q", r.Header.Get("Host"))
+		}
+		if r.URL.Path != "/a6ppmxmplalwlvyl5mldi2p2oq0hpkrc/path" {
+			t.Errorf("expected path not to be stripped, got %q", r.URL.Path)
+		}
+		p, ok := GetIAMPrincipal(r.Context())
+		if !ok {
+			t.Fatal("expected IAM principal")
+		}
+		if p.UserARN != "arn:aws:iam::123456789012:user/gopher" {
+			t.Errorf("unexpected user ARN %q", p.UserARN)
+		}
+	})
+
+	// Act.
+	_, err := NewLambdaHandler(h, WithStripStage()).Handle(context.Background(), e)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !called {
+		t.Error("handler was not called")
+	}
+}
+
+func TestGetIAMPrincipalWithoutIAMAuth(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := GetIAMPrincipal(r.Context()); ok {
+			t.Error("expected no IAM principal")
+		}
+		if IsFunctionURLRequest(r.Context()) {
+			t.Error("expected API Gateway request")
+		}
+	})
+	NewLambdaHandler(h).Handle(context.Background(), loadConformanceEvent(t, "jwt-authorizer"))
+	if _, ok := GetIAMPrincipal(context.Background()); ok {
+		t.Error("expected no IAM principal outside of a request")
+	}
+}
+
+func TestStripStage(t *testing.T) {
+	tests := []struct {
+		path     string
+		stage    string
+		expected string
+	}{
+		{path: "/prod/users", stage: "prod", expected: "/users"},
+		{path: "/prod", stage: "prod", expected: "/"},
+		{path: "/production/users", stage: "prod", expected: "/production/users"},
+		{path: "/users", stage: "$default", expected: "/users"},
+		{path: "/users", stage: "", expected: "/users"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if actual := stripStage(test.path, test.stage); actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
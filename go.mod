@@ -1,6 +1,6 @@
 module github.com/a-h/awsapigatewayv2handler
 
-go 1.17
+go 1.21
 
 require (
 	github.com/aws/aws-lambda-go v1.32.1
@@ -4,69 +4,236 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
-	"encoding/json"
 	"io"
+	"log/slog"
+	"mime"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-lambda-go/lambda"
 )
 
-func ListenAndServe(h http.Handler) {
+// ListenAndServe starts a Lambda function that handles API Gateway V2 events with h, or
+// http.DefaultServeMux if h is nil. See LambdaHandler for how request bodies are handled.
+func ListenAndServe(h http.Handler, opts ...Option) {
 	if h == nil {
 		h = http.DefaultServeMux
 	}
-	lambda.StartHandler(NewLambdaHandler(h))
+	NewLambdaHandler(h, opts...).Start()
 }
 
-func NewLambdaHandler(h http.Handler) LambdaHandler {
-	return LambdaHandler{
+func NewLambdaHandler(h http.Handler, opts ...Option) LambdaHandler {
+	lh := LambdaHandler{
 		Handler: h,
 	}
+	for _, opt := range opts {
+		opt(&lh)
+	}
+	return lh
 }
 
+// Option configures a LambdaHandler.
+type Option func(lh *LambdaHandler)
+
+// LambdaHandler converts API Gateway V2 events into HTTP requests for a http.Handler.
+//
+// Base64 encoded request bodies are decoded into buffers that are reused by later requests once
+// ServeHTTP returns, so handlers must not read r.Body after they return, e.g. from another goroutine.
+// Read the body into a new slice first with io.ReadAll.
 type LambdaHandler struct {
-	Handler http.Handler
+	Handler             http.Handler
+	requestErrorHandler RequestErrorHandlerFunc
+	stripStage          bool
+	onShutdown          []func(ctx context.Context)
+	beforeRequest       []BeforeRequestFunc
+	afterResponse       []AfterResponseFunc
+	observers           []ObserveFunc
+	accessLog           *slog.Logger
+	accessLogLevel      slog.Level
+	metrics             *metricsConfig
+	invocationHeaders   bool
+	traceParent         bool
+	cors                *CORSOptions
+	trustedProxies      []netip.Prefix
+	codec               JSONCodec
+	etags               bool
+	ranges              bool
+}
+
+// WithStripStage removes the stage name from the start of request paths, e.g. /prod/users becomes /users.
+// API Gateway includes the stage name in the path unless the $default stage is used. Lambda function URLs
+// don't have stages, so their paths are never modified.
+func WithStripStage() Option {
+	return func(lh *LambdaHandler) {
+		lh.stripStage = true
+	}
 }
 
 func (lh LambdaHandler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	if lh.codec != nil {
+		return lh.invokeWithCodec(ctx, payload)
+	}
 	var req events.APIGatewayV2HTTPRequest
-	err := json.Unmarshal(payload, &req)
+	err := decodeRequest(payload, &req)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := lh.Handle(ctx, req)
+	// After response hooks can read the body, so it's only left unencoded if there aren't any.
+	resp, binary, err := lh.serve(ctx, req, len(lh.afterResponse) > 0)
 	if err != nil {
 		return nil, err
 	}
-	return json.Marshal(resp)
+	return encodeResponse(resp, binary), nil
 }
 
 func (lh LambdaHandler) Handle(ctx context.Context, e events.APIGatewayV2HTTPRequest) (resp events.APIGatewayV2HTTPResponse, err error) {
+	resp, _, err = lh.serve(ctx, e, true)
+	return
+}
+
+// serve handles the event. If encodeBinary is false, binary response bodies are returned without being
+// base64 encoded, and resp.Body is empty, so that they can be encoded straight into the Invoke response.
+func (lh LambdaHandler) serve(ctx context.Context, e events.APIGatewayV2HTTPRequest, encodeBinary bool) (resp events.APIGatewayV2HTTPResponse, binary []byte, err error) {
+	start := time.Now()
+	inv := newInvocation(start)
+	ctx = context.WithValue(ctx, invocationContextKey{}, inv)
+	if th, ok := getTraceHeader(ctx, e); ok {
+		ctx = context.WithValue(ctx, traceHeaderContextKey{}, th)
+	}
+	if lh.accessLog != nil {
+		ctx = context.WithValue(ctx, loggerContextKey{}, lh.accessLog)
+	}
+	observed := make([]func(events.APIGatewayV2HTTPResponse, int, error), len(lh.observers))
+	for i, f := range lh.observers {
+		ctx, observed[i] = f(ctx, e)
+	}
+	if lh.accessLog != nil || lh.metrics != nil || len(observed) > 0 {
+		defer func() {
+			duration := time.Since(start)
+			responseBytes := bodyLength(resp.Body, resp.IsBase64Encoded)
+			if binary != nil {
+				responseBytes = len(binary)
+			}
+			for i := len(observed) - 1; i >= 0; i-- {
+				observed[i](resp, responseBytes, err)
+			}
+			if lh.metrics != nil {
+				if merr := lh.metrics.write(e, resp, responseBytes, err, start, duration, inv.ColdStart); merr != nil {
+					GetLogger(ctx).Error("failed to write metrics", slog.Any("error", merr))
+				}
+			}
+			if lh.accessLog != nil {
+				lh.logAccess(ctx, e, resp, responseBytes, err, duration, inv.ColdStart)
+			}
+		}()
+	}
+	if err = lh.runBeforeRequest(ctx, &e); err != nil {
+		return
+	}
+	if resp, binary, err = lh.handle(ctx, e, encodeBinary); err != nil {
+		return
+	}
+	if lh.invocationHeaders {
+		setInvocationHeaders(&resp, inv)
+	}
+	err = lh.runAfterResponse(ctx, e, &resp)
+	return
+}
+
+func (lh LambdaHandler) handle(ctx context.Context, e events.APIGatewayV2HTTPRequest, encodeBinary bool) (resp events.APIGatewayV2HTTPResponse, binary []byte, err error) {
+	if lh.cors != nil {
+		if isPreflight(e) {
+			return lh.cors.preflight(e), nil, nil
+		}
+		defer func() {
+			if err == nil {
+				lh.cors.setHeaders(e, &resp)
+			}
+		}()
+	}
+
 	// Convert the event to a HTTP request.
 	r, err := lh.convertLambdaEventToHTTPRequest(e)
 	if err != nil {
+		resp, err = lh.handleRequestError(ctx, e, err)
 		return
 	}
+	if lh.traceParent && r.Header.Get("traceparent") == "" {
+		if th, ok := GetTraceHeader(ctx); ok {
+			if tp, ok := th.TraceParent(); ok {
+				r.Header.Set("traceparent", tp)
+			}
+		}
+	}
+
+	if pb, ok := r.Body.(*pooledBody); ok {
+		defer pb.release()
+	}
 
 	// Execute the request.
 	w := httptest.NewRecorder()
-	lh.Handler.ServeHTTP(w, r.WithContext(ctx))
+	lh.Handler.ServeHTTP(w, r.WithContext(context.WithValue(ctx, eventContextKey{}, e)))
+	if lh.etags {
+		w = conditionalResponse(r, w)
+	}
+	if lh.ranges {
+		w = rangeResponse(r, w)
+	}
 
 	// Convert the recorded result to an API Gateway response.
-	return lh.convertHTTPResponseToLambdaEvent(w)
+	return lh.convertHTTPResponseToLambdaEvent(w, encodeBinary)
 }
 
 func (lh LambdaHandler) convertLambdaEventToHTTPRequest(e events.APIGatewayV2HTTPRequest) (req *http.Request, err error) {
-	body, cl := getRequestBody(e.Body, e.IsBase64Encoded)
-	req, err = http.NewRequest(e.RequestContext.HTTP.Method, e.RawPath, body)
+	body, cl, err := getRequestBody(e.Body, e.IsBase64Encoded)
+	if err != nil {
+		return nil, &RequestError{Field: "body", Err: err}
+	}
+	if pb, ok := body.(*pooledBody); ok {
+		defer func() {
+			if err != nil {
+				pb.release()
+			}
+		}()
+	}
+	req, err = http.NewRequest(e.RequestContext.HTTP.Method, "/", body)
+	if err != nil {
+		return nil, &RequestError{Field: "method", Err: err}
+	}
+	// Parse the path as a request URI, so that paths starting with // aren't parsed as a host.
+	rawPath := e.RawPath
+	if lh.stripStage && !IsFunctionURL(e) {
+		rawPath = stripStage(rawPath, e.RequestContext.Stage)
+	}
+	if rawPath == "" {
+		rawPath = "/"
+	}
+	req.URL, err = url.ParseRequestURI(rawPath)
+	if err != nil {
+		return nil, &RequestError{Field: "path", Err: err}
+	}
 	req.URL.RawQuery = e.RawQueryString
 	for k, v := range e.Headers {
 		req.Header.Add(k, v)
 	}
+	// Payload format 2.0 events move the Cookie header into the Cookies field.
+	if len(e.Cookies) > 0 && req.Header.Get("Cookie") == "" {
+		req.Header.Set("Cookie", strings.Join(e.Cookies, "; "))
+	}
+	// Like net/http servers, move the Host header to the Host field.
+	req.Host = req.Header.Get("Host")
+	if req.Host == "" {
+		req.Host = e.RequestContext.DomainName
+	}
+	req.Header.Del("Host")
+	req.RemoteAddr = lh.remoteAddr(e)
 	if cl > 0 {
 		req.Header.Set("Content-Length", strconv.Itoa(cl))
 		req.ContentLength = int64(cl)
@@ -74,29 +241,83 @@ func (lh LambdaHandler) convertLambdaEventToHTTPRequest(e events.APIGatewayV2HTT
 	return
 }
 
-func getRequestBody(s string, isBase64Encoded bool) (body io.Reader, contentLength int) {
+func stripStage(path, stage string) string {
+	if stage == "" || stage == "$default" {
+		return path
+	}
+	prefix := "/" + stage
+	if path == prefix {
+		return "/"
+	}
+	if strings.HasPrefix(path, prefix+"/") {
+		return path[len(prefix):]
+	}
+	return path
+}
+
+type eventContextKey struct{}
+
+// GetEvent returns the API Gateway event that the request was converted from. It's available in the
+// context of requests passed to the http.Handler of a LambdaHandler.
+func GetEvent(ctx context.Context) (e events.APIGatewayV2HTTPRequest, ok bool) {
+	e, ok = ctx.Value(eventContextKey{}).(events.APIGatewayV2HTTPRequest)
+	return
+}
+
+// getRequestBody returns a reader for the event body. Text bodies are read from the string without
+// copying. Base64 bodies are decoded up front, so that invalid data is rejected, and the content length
+// is exact.
+func getRequestBody(s string, isBase64Encoded bool) (body io.Reader, contentLength int, err error) {
 	if s == "" {
-		return http.NoBody, -1
-	}
-	if isBase64Encoded {
-		var padding int
-		if len(s) > 1 {
-			for _, c := range s[len(s)-2:] {
-				if c == '=' {
-					padding++
-				}
-			}
-		}
-		contentLength = (3 * (len(s) / 4)) - padding
-		return base64.NewDecoder(base64.StdEncoding, bytes.NewReader([]byte(s))), contentLength
+		return http.NoBody, -1, nil
+	}
+	if !isBase64Encoded {
+		return strings.NewReader(s), len(s), nil
+	}
+	buf := requestBodyPool.Get().(*[]byte)
+	if cap(*buf) < base64.StdEncoding.DecodedLen(len(s)) {
+		*buf = make([]byte, base64.StdEncoding.DecodedLen(len(s)))
 	}
-	return bytes.NewReader([]byte(s)), len(s)
+	n, err := base64.StdEncoding.Decode((*buf)[:cap(*buf)], []byte(s))
+	if err != nil {
+		requestBodyPool.Put(buf)
+		return nil, 0, err
+	}
+	pb := &pooledBody{buf: buf}
+	pb.Reset((*buf)[:n])
+	return pb, n, nil
 }
 
-func (lh LambdaHandler) convertHTTPResponseToLambdaEvent(rec *httptest.ResponseRecorder) (resp events.APIGatewayV2HTTPResponse, err error) {
+var requestBodyPool = sync.Pool{
+	New: func() any {
+		return new([]byte)
+	},
+}
+
+// pooledBody is a request body that uses a buffer from the pool. The buffer is returned to the pool once
+// the handler has returned, so handlers mustn't read the body after that.
+type pooledBody struct {
+	bytes.Reader
+	buf *[]byte
+}
+
+func (pb *pooledBody) Close() error {
+	return nil
+}
+
+func (pb *pooledBody) release() {
+	pb.Reset(nil)
+	requestBodyPool.Put(pb.buf)
+}
+
+func (lh LambdaHandler) convertHTTPResponseToLambdaEvent(rec *httptest.ResponseRecorder, encodeBinary bool) (resp events.APIGatewayV2HTTPResponse, binary []byte, err error) {
 	result := rec.Result()
 	resp.StatusCode = result.StatusCode
-	resp.Body, resp.IsBase64Encoded = lh.getResponseBody(rec)
+	if encodeBinary || isTextBody(rec) {
+		resp.Body, resp.IsBase64Encoded = lh.getResponseBody(rec)
+	} else {
+		binary, resp.IsBase64Encoded = rec.Body.Bytes(), true
+	}
 	resp.Headers = make(map[string]string, len(result.Header)+len(result.Trailer))
 	for k, v := range result.Header {
 		resp.Headers[k] = strings.Join(v, ",")
@@ -109,6 +330,8 @@ func (lh LambdaHandler) convertHTTPResponseToLambdaEvent(rec *httptest.ResponseR
 	}
 	cookies := result.Cookies()
 	if len(cookies) > 0 {
+		// API Gateway sends each cookie as a Set-Cookie header, so the joined header would duplicate them.
+		delete(resp.Headers, "Set-Cookie")
 		resp.Cookies = make([]string, len(cookies))
 		for i := 0; i < len(cookies); i++ {
 			resp.Cookies[i] = cookies[i].String()
@@ -118,18 +341,27 @@ func (lh LambdaHandler) convertHTTPResponseToLambdaEvent(rec *httptest.ResponseR
 }
 
 func (lh LambdaHandler) getResponseBody(rec *httptest.ResponseRecorder) (body string, isBase64Encoded bool) {
-	if isTextType(rec.HeaderMap.Get("Content-Type")) {
+	if isTextBody(rec) {
 		return rec.Body.String(), false
 	}
 	return base64.StdEncoding.EncodeToString(rec.Body.Bytes()), true
 }
 
+func isTextBody(rec *httptest.ResponseRecorder) bool {
+	// Invalid UTF-8 can't be represented in a JSON string, so it's base64 encoded, even if it's meant to be text.
+	return isTextType(rec.HeaderMap.Get("Content-Type")) && utf8.Valid(rec.Body.Bytes())
+}
+
 func isTextType(contentType string) bool {
 	if contentType == "" {
 		// API Gateway's default Content-Type is application/json
 		// See https://docs.aws.amazon.com/apigateway/latest/developerguide/request-response-data-mappings.html
 		return true
 	}
+	// Parameters such as charset don't change whether the content is text.
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
 	if strings.HasPrefix(contentType, "text/") {
 		return true
 	}
@@ -0,0 +1,65 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// BeforeRequestFunc is called with the API Gateway event before it's converted to a HTTP request. It can
+// modify the event.
+type BeforeRequestFunc func(ctx context.Context, e *events.APIGatewayV2HTTPRequest) error
+
+// AfterResponseFunc is called with the API Gateway response event before it's returned to API Gateway.
+// It can modify the response.
+type AfterResponseFunc func(ctx context.Context, e events.APIGatewayV2HTTPRequest, resp *events.APIGatewayV2HTTPResponse) error
+
+// WithBeforeRequest adds a function to run before each event is converted to a HTTP request. Functions
+// run in the order they're added. If a function returns an error, the remaining functions and the
+// http.Handler aren't called, and the error is returned from the Lambda function.
+func WithBeforeRequest(f BeforeRequestFunc) Option {
+	return func(lh *LambdaHandler) {
+		lh.beforeRequest = append(lh.beforeRequest, f)
+	}
+}
+
+// WithAfterResponse adds a function to run after each response event is created, including responses to
+// events that couldn't be converted to HTTP requests. Functions run in the reverse order that they're
+// added, so that the first function added sees the final response. If a function returns an error, the
+// remaining functions aren't called, and the error is returned from the Lambda function.
+func WithAfterResponse(f AfterResponseFunc) Option {
+	return func(lh *LambdaHandler) {
+		lh.afterResponse = append(lh.afterResponse, f)
+	}
+}
+
+// ObserveFunc is called at the start of each invocation, before any before request hooks, e.g. to start a
+// trace span. It returns the context used to handle the event, and a function that's called at the end of
+// the invocation with the response, the size of the response body in bytes, and any error.
+type ObserveFunc func(ctx context.Context, e events.APIGatewayV2HTTPRequest) (context.Context, func(resp events.APIGatewayV2HTTPResponse, responseBytes int, err error))
+
+// WithObserver adds a function to observe each invocation. Unlike after response hooks, observers don't
+// prevent binary response bodies from being streamed into the Invoke response.
+func WithObserver(f ObserveFunc) Option {
+	return func(lh *LambdaHandler) {
+		lh.observers = append(lh.observers, f)
+	}
+}
+
+func (lh LambdaHandler) runBeforeRequest(ctx context.Context, e *events.APIGatewayV2HTTPRequest) (err error) {
+	for _, f := range lh.beforeRequest {
+		if err = f(ctx, e); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (lh LambdaHandler) runAfterResponse(ctx context.Context, e events.APIGatewayV2HTTPRequest, resp *events.APIGatewayV2HTTPResponse) (err error) {
+	for i := len(lh.afterResponse) - 1; i >= 0; i-- {
+		if err = lh.afterResponse[i](ctx, e, resp); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,198 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHooks(t *testing.T) {
+	t.Run("hooks run in order around the handler", func(t *testing.T) {
+		// Arrange.
+		var calls []string
+		before := func(name string) Option {
+			return WithBeforeRequest(func(ctx context.Context, e *events.APIGatewayV2HTTPRequest) error {
+				calls = append(calls, "before "+name)
+				return nil
+			})
+		}
+		after := func(name string) Option {
+			return WithAfterResponse(func(ctx context.Context, e events.APIGatewayV2HTTPRequest, resp *events.APIGatewayV2HTTPResponse) error {
+				calls = append(calls, "after "+name)
+				return nil
+			})
+		}
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "handler")
+		})
+		lh := NewLambdaHandler(h, before("1"), after("1"), before("2"), after("2"))
+
+		// Act.
+		_, err := lh.Handle(context.Background(), events.APIGatewayV2HTTPRequest{RawPath: "/"})
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []string{"before 1", "before 2", "handler", "after 2", "after 1"}
+		if diff := cmp.Diff(expected, calls); diff != "" {
+			t.Error(diff)
+		}
+	})
+	t.Run("hooks can modify the event and response", func(t *testing.T) {
+		// Arrange.
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			w.Write(body)
+		})
+		lh := NewLambdaHandler(h,
+			WithBeforeRequest(func(ctx context.Context, e *events.APIGatewayV2HTTPRequest) error {
+				e.Body = "modified"
+				return nil
+			}),
+			WithAfterResponse(func(ctx context.Context, e events.APIGatewayV2HTTPRequest, resp *events.APIGatewayV2HTTPResponse) error {
+				if e.Body != "modified" {
+					t.Errorf("expected modified event, got body %q", e.Body)
+				}
+				resp.Cookies = append(resp.Cookies, "added=true")
+				return nil
+			}),
+		)
+
+		// Act.
+		resp, err := lh.Handle(context.Background(), events.APIGatewayV2HTTPRequest{RawPath: "/", Body: "original"})
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.Body != "modified" {
+			t.Errorf("expected body %q, got %q", "modified", resp.Body)
+		}
+		if diff := cmp.Diff([]string{"added=true"}, resp.Cookies); diff != "" {
+			t.Error(diff)
+		}
+	})
+	t.Run("before request errors short-circuit", func(t *testing.T) {
+		// Arrange.
+		expectedErr := errors.New("rejected")
+		var calls []string
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "handler")
+		})
+		lh := NewLambdaHandler(h,
+			WithBeforeRequest(func(ctx context.Context, e *events.APIGatewayV2HTTPRequest) error {
+				return expectedErr
+			}),
+			WithBeforeRequest(func(ctx context.Context, e *events.APIGatewayV2HTTPRequest) error {
+				calls = append(calls, "before 2")
+				return nil
+			}),
+			WithAfterResponse(func(ctx context.Context, e events.APIGatewayV2HTTPRequest, resp *events.APIGatewayV2HTTPResponse) error {
+				calls = append(calls, "after")
+				return nil
+			}),
+		)
+
+		// Act.
+		_, err := lh.Handle(context.Background(), events.APIGatewayV2HTTPRequest{RawPath: "/"})
+
+		// Assert.
+		if !errors.Is(err, expectedErr) {
+			t.Errorf("expected error %v, got %v", expectedErr, err)
+		}
+		if len(calls) != 0 {
+			t.Errorf("expected no further calls, got %v", calls)
+		}
+	})
+	t.Run("after response errors short-circuit", func(t *testing.T) {
+		// Arrange.
+		expectedErr := errors.New("failed")
+		var calls []string
+		lh := NewLambdaHandler(http.NotFoundHandler(),
+			WithAfterResponse(func(ctx context.Context, e events.APIGatewayV2HTTPRequest, resp *events.APIGatewayV2HTTPResponse) error {
+				calls = append(calls, "after 1")
+				return nil
+			}),
+			WithAfterResponse(func(ctx context.Context, e events.APIGatewayV2HTTPRequest, resp *events.APIGatewayV2HTTPResponse) error {
+				return expectedErr
+			}),
+		)
+
+		// Act.
+		_, err := lh.Handle(context.Background(), events.APIGatewayV2HTTPRequest{RawPath: "/"})
+
+		// Assert.
+		if !errors.Is(err, expectedErr) {
+			t.Errorf("expected error %v, got %v", expectedErr, err)
+		}
+		if len(calls) != 0 {
+			t.Errorf("expected no further calls, got %v", calls)
+		}
+	})
+	t.Run("after response hooks see request error responses", func(t *testing.T) {
+		// Arrange.
+		var status int
+		lh := NewLambdaHandler(http.NotFoundHandler(),
+			WithAfterResponse(func(ctx context.Context, e events.APIGatewayV2HTTPRequest, resp *events.APIGatewayV2HTTPResponse) error {
+				status = resp.StatusCode
+				return nil
+			}),
+		)
+
+		// Act.
+		_, err := lh.Handle(context.Background(), invalidBodyEvent)
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if status != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", status)
+		}
+	})
+	t.Run("observers see streamed binary responses", func(t *testing.T) {
+		// Arrange.
+		type ctxKey struct{}
+		var calls []string
+		var observedStatus, observedBytes int
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "handler "+r.Context().Value(ctxKey{}).(string))
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G'})
+		})
+		lh := NewLambdaHandler(h,
+			WithObserver(func(ctx context.Context, e events.APIGatewayV2HTTPRequest) (context.Context, func(events.APIGatewayV2HTTPResponse, int, error)) {
+				calls = append(calls, "observe")
+				return context.WithValue(ctx, ctxKey{}, "observed"), func(resp events.APIGatewayV2HTTPResponse, responseBytes int, err error) {
+					calls = append(calls, "done")
+					observedStatus, observedBytes = resp.StatusCode, responseBytes
+				}
+			}),
+			WithBeforeRequest(func(ctx context.Context, e *events.APIGatewayV2HTTPRequest) error {
+				calls = append(calls, "before")
+				return nil
+			}),
+		)
+
+		// Act.
+		_, err := lh.Invoke(context.Background(), []byte(`{"rawPath":"/","requestContext":{"http":{"method":"GET"}}}`))
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []string{"observe", "before", "handler observed", "done"}
+		if diff := cmp.Diff(expected, calls); diff != "" {
+			t.Error(diff)
+		}
+		if observedStatus != http.StatusOK || observedBytes != 4 {
+			t.Errorf("expected status 200 and 4 bytes, got %d and %d", observedStatus, observedBytes)
+		}
+	})
+}
@@ -0,0 +1,209 @@
+package awsapigatewayv2handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// EventHandlerFunc is the signature of a Lambda function that handles API Gateway V2 HTTP events.
+type EventHandlerFunc func(ctx context.Context, e events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error)
+
+// NewHTTPHandler converts a Lambda API Gateway V2 handler function into a http.Handler.
+// It's the inverse of NewLambdaHandler.
+func NewHTTPHandler(f EventHandlerFunc) HTTPHandler {
+	return HTTPHandler{
+		Handler: f,
+	}
+}
+
+type HTTPHandler struct {
+	Handler EventHandlerFunc
+	// SigV4 verifies that requests are signed, and sets the IAM authorizer of the event to the signer, to
+	// emulate AWS_IAM authorization. If nil, requests aren't verified.
+	SigV4 *SigV4Verifier
+}
+
+func (hh HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var iam *events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription
+	if hh.SigV4 != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		identity, err := hh.SigV4.Verify(r, body)
+		if err != nil {
+			writeForbidden(w)
+			return
+		}
+		iam = &identity
+	}
+	e, err := convertHTTPRequestToLambdaEvent(r)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if iam != nil {
+		e.RequestContext.Authorizer = &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{IAM: iam}
+	}
+	resp, err := hh.Handler(r.Context(), e)
+	if err != nil {
+		writeInternalServerError(w)
+		return
+	}
+	writeLambdaEventToHTTPResponse(w, resp)
+}
+
+// writeInternalServerError writes the response that API Gateway returns when a Lambda function fails.
+func writeInternalServerError(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	io.WriteString(w, `{"message":"Internal Server Error"}`)
+}
+
+// writeForbidden writes the response that API Gateway returns when a request isn't authorized.
+func writeForbidden(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	io.WriteString(w, `{"message":"Forbidden"}`)
+}
+
+// NewEvent converts a HTTP request into the API Gateway V2 event that API Gateway would send to a Lambda
+// function if it had received the request. The request body is consumed.
+func NewEvent(r *http.Request) (events.APIGatewayV2HTTPRequest, error) {
+	return convertHTTPRequestToLambdaEvent(r)
+}
+
+func convertHTTPRequestToLambdaEvent(r *http.Request) (e events.APIGatewayV2HTTPRequest, err error) {
+	now := time.Now().UTC()
+	requestID, err := newRequestID()
+	if err != nil {
+		return e, fmt.Errorf("failed to create request ID: %w", err)
+	}
+	e.Version = "2.0"
+	e.RouteKey = "$default"
+	e.RawPath = r.URL.EscapedPath()
+	e.RawQueryString = r.URL.RawQuery
+	e.Cookies = getRequestCookies(r)
+	e.Headers = make(map[string]string, len(r.Header)+1)
+	for k, v := range r.Header {
+		k = strings.ToLower(k)
+		if k == "cookie" {
+			continue
+		}
+		e.Headers[k] = strings.Join(v, ",")
+	}
+	if r.Host != "" {
+		e.Headers["host"] = r.Host
+	}
+	if q := r.URL.Query(); len(q) > 0 {
+		e.QueryStringParameters = make(map[string]string, len(q))
+		for k, v := range q {
+			e.QueryStringParameters[k] = strings.Join(v, ",")
+		}
+	}
+	e.RequestContext = events.APIGatewayV2HTTPRequestContext{
+		RouteKey:   "$default",
+		Stage:      "$default",
+		RequestID:  requestID,
+		DomainName: r.Host,
+		Time:       now.Format("02/Jan/2006:15:04:05 -0700"),
+		TimeEpoch:  now.UnixNano() / int64(time.Millisecond),
+		HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+			Method:    r.Method,
+			Path:      r.URL.EscapedPath(),
+			Protocol:  r.Proto,
+			SourceIP:  getSourceIP(r.RemoteAddr),
+			UserAgent: r.UserAgent(),
+		},
+	}
+	e.RequestContext.DomainPrefix = strings.SplitN(r.Host, ".", 2)[0]
+	e.Body, e.IsBase64Encoded, err = getEventBody(r)
+	return
+}
+
+func getRequestCookies(r *http.Request) (cookies []string) {
+	for _, c := range r.Cookies() {
+		cookies = append(cookies, c.String())
+	}
+	return
+}
+
+func getSourceIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+func getEventBody(r *http.Request) (body string, isBase64Encoded bool, err error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	if len(data) == 0 {
+		return
+	}
+	if isTextType(r.Header.Get("Content-Type")) && utf8.Valid(data) {
+		return string(data), false, nil
+	}
+	return base64.StdEncoding.EncodeToString(data), true, nil
+}
+
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeLambdaEventToHTTPResponse(w http.ResponseWriter, resp events.APIGatewayV2HTTPResponse) {
+	body := []byte(resp.Body)
+	if resp.IsBase64Encoded {
+		var err error
+		body, err = base64.StdEncoding.DecodeString(resp.Body)
+		if err != nil {
+			writeInternalServerError(w)
+			return
+		}
+	}
+	for k, v := range resp.MultiValueHeaders {
+		for _, vv := range v {
+			w.Header().Add(k, vv)
+		}
+	}
+	for k, v := range resp.Headers {
+		// Cookies are written from the Cookies field, since the Set-Cookie header can't be split on commas.
+		if len(resp.Cookies) > 0 && http.CanonicalHeaderKey(k) == "Set-Cookie" {
+			continue
+		}
+		w.Header().Set(k, v)
+	}
+	for _, c := range resp.Cookies {
+		w.Header().Add("Set-Cookie", c)
+	}
+	statusCode := resp.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
@@ -0,0 +1,341 @@
+package awsapigatewayv2handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHTTPRequestToLambdaEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  func() *http.Request
+		expected func(e events.APIGatewayV2HTTPRequest) error
+	}{
+		{
+			name: "method, path and querystring",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "http://example.com/a%2Fb/c?x=1&x=2&y=3", http.NoBody)
+			},
+			expected: func(e events.APIGatewayV2HTTPRequest) error {
+				if e.RequestContext.HTTP.Method != http.MethodPost {
+					return errors.New("unexpected method: " + e.RequestContext.HTTP.Method)
+				}
+				if e.RawPath != "/a%2Fb/c" {
+					return errors.New("unexpected raw path: " + e.RawPath)
+				}
+				if e.RequestContext.HTTP.Path != "/a%2Fb/c" {
+					return errors.New("unexpected path: " + e.RequestContext.HTTP.Path)
+				}
+				if e.RawQueryString != "x=1&x=2&y=3" {
+					return errors.New("unexpected raw querystring: " + e.RawQueryString)
+				}
+				if e.QueryStringParameters["x"] != "1,2" {
+					return errors.New("unexpected querystring value: " + e.QueryStringParameters["x"])
+				}
+				if e.RequestContext.DomainName != "example.com" {
+					return errors.New("unexpected domain: " + e.RequestContext.DomainName)
+				}
+				if e.RequestContext.HTTP.SourceIP != "192.0.2.1" {
+					return errors.New("unexpected source IP: " + e.RequestContext.HTTP.SourceIP)
+				}
+				return nil
+			},
+		},
+		{
+			name: "headers are lowercased and cookies are moved to the cookies field",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+				r.Header.Add("X-Custom", "a")
+				r.Header.Add("X-Custom", "b")
+				r.AddCookie(&http.Cookie{Name: "name", Value: "value"})
+				r.AddCookie(&http.Cookie{Name: "name2", Value: "value2"})
+				return r
+			},
+			expected: func(e events.APIGatewayV2HTTPRequest) error {
+				if e.Headers["x-custom"] != "a,b" {
+					return errors.New("unexpected header value: " + e.Headers["x-custom"])
+				}
+				if _, ok := e.Headers["cookie"]; ok {
+					return errors.New("unexpected cookie header")
+				}
+				if diff := cmp.Diff([]string{"name=value", "name2=value2"}, e.Cookies); diff != "" {
+					return errors.New("cookies:\n" + diff)
+				}
+				return nil
+			},
+		},
+		{
+			name: "text bodies are not encoded",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"key":"value"}`))
+				r.Header.Set("Content-Type", "application/json")
+				return r
+			},
+			expected: func(e events.APIGatewayV2HTTPRequest) error {
+				if e.IsBase64Encoded {
+					return errors.New("expected text body not to be base64 encoded")
+				}
+				if e.Body != `{"key":"value"}` {
+					return errors.New("unexpected body: " + e.Body)
+				}
+				return nil
+			},
+		},
+		{
+			name: "text bodies with a charset are not encoded",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`<key>value</key>`))
+				r.Header.Set("Content-Type", "application/xml; charset=utf-8")
+				return r
+			},
+			expected: func(e events.APIGatewayV2HTTPRequest) error {
+				if e.IsBase64Encoded {
+					return errors.New("expected text body not to be base64 encoded")
+				}
+				return nil
+			},
+		},
+		{
+			name: "binary bodies are base64 encoded",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte{0, 1, 2, 3}))
+				r.Header.Set("Content-Type", "application/octet-stream")
+				return r
+			},
+			expected: func(e events.APIGatewayV2HTTPRequest) error {
+				if !e.IsBase64Encoded {
+					return errors.New("expected binary body to be base64 encoded")
+				}
+				if e.Body != base64.StdEncoding.EncodeToString([]byte{0, 1, 2, 3}) {
+					return errors.New("unexpected body: " + e.Body)
+				}
+				return nil
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := convertHTTPRequestToLambdaEvent(test.request())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err = test.expected(actual); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        EventHandlerFunc
+		expectedStatus int
+		expectedHeader http.Header
+		expectedBody   string
+	}{
+		{
+			name: "text response",
+			handler: func(ctx context.Context, e events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+				return events.APIGatewayV2HTTPResponse{
+					StatusCode: http.StatusCreated,
+					Headers: map[string]string{
+						"Content-Type": "text/plain",
+					},
+					Body: "Hello, World",
+				}, nil
+			},
+			expectedStatus: http.StatusCreated,
+			expectedHeader: http.Header{
+				"Content-Type": []string{"text/plain"},
+			},
+			expectedBody: "Hello, World",
+		},
+		{
+			name: "base64 response bodies are decoded",
+			handler: func(ctx context.Context, e events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+				return events.APIGatewayV2HTTPResponse{
+					StatusCode: http.StatusOK,
+					Headers: map[string]string{
+						"Content-Type": "image/jpeg",
+					},
+					Body:            base64.StdEncoding.EncodeToString([]byte("test")),
+					IsBase64Encoded: true,
+				}, nil
+			},
+			expectedStatus: http.StatusOK,
+			expectedHeader: http.Header{
+				"Content-Type": []string{"image/jpeg"},
+			},
+			expectedBody: "test",
+		},
+		{
+			name: "cookies are written as Set-Cookie headers",
+			handler: func(ctx context.Context, e events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+				return events.APIGatewayV2HTTPResponse{
+					StatusCode: http.StatusOK,
+					Headers: map[string]string{
+						"Set-Cookie": "cookie1=value1,cookie2=value2",
+					},
+					Cookies: []string{"cookie1=value1", "cookie2=value2"},
+				}, nil
+			},
+			expectedStatus: http.StatusOK,
+			expectedHeader: http.Header{
+				"Set-Cookie": []string{"cookie1=value1", "cookie2=value2"},
+			},
+		},
+		{
+			name: "missing status codes default to 200",
+			handler: func(ctx context.Context, e events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+				return events.APIGatewayV2HTTPResponse{Body: "OK"}, nil
+			},
+			expectedStatus: http.StatusOK,
+			expectedHeader: http.Header{},
+			expectedBody:   "OK",
+		},
+		{
+			name: "errors return an internal server error",
+			handler: func(ctx context.Context, e events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+				return events.APIGatewayV2HTTPResponse{}, errors.New("failed")
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedHeader: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			expectedBody: `{"message":"Internal Server Error"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+
+			// Act.
+			NewHTTPHandler(test.handler).ServeHTTP(w, r)
+
+			// Assert.
+			if w.Code != test.expectedStatus {
+				t.Errorf("expected status %d, got %d", test.expectedStatus, w.Code)
+			}
+			if diff := cmp.Diff(test.expectedHeader, w.Header()); diff != "" {
+				t.Errorf("header:\n%s", diff)
+			}
+			if diff := cmp.Diff(test.expectedBody, w.Body.String()); diff != "" {
+				t.Errorf("body:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHTTPHandlerRoundTrip(t *testing.T) {
+	// Arrange.
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.SetCookie(w, &http.Cookie{Name: "name", Value: "value"})
+		w.Write(body)
+	})
+	hh := NewHTTPHandler(NewLambdaHandler(h).Handle)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/path?a=1", bytes.NewReader(binaryData))
+	r.Header.Set("Content-Type", "application/octet-stream")
+
+	// Act.
+	hh.ServeHTTP(w, r)
+
+	// Assert.
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+	if !bytes.Equal(w.Body.Bytes(), binaryData) {
+		t.Errorf("the response body was corrupted")
+	}
+	if diff := cmp.Diff([]string{"name=value"}, w.Header().Values("Set-Cookie")); diff != "" {
+		t.Errorf("cookies:\n%s", diff)
+	}
+}
+
+func TestHTTPHandlerSigV4(t *testing.T) {
+	creds := Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}
+	lookup := func(ctx context.Context, accessKeyID string) (string, events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription, error) {
+		return creds.SecretAccessKey, events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription{
+			UserARN: "arn:aws:iam::123456789012:user/gopher",
+		}, nil
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := GetIAMPrincipal(r.Context())
+		if !ok {
+			t.Error("expected IAM principal")
+		}
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, p.UserARN+" "+string(body))
+	})
+	hh := NewHTTPHandler(NewLambdaHandler(h).Handle)
+	hh.SigV4 = &SigV4Verifier{Lookup: lookup, Service: "lambda"}
+	s := httptest.NewServer(hh)
+	defer s.Close()
+	tests := []struct {
+		name             string
+		sign             bool
+		expectedStatus   int
+		expectedResponse string
+	}{
+		{
+			name:             "signed requests populate the IAM authorizer",
+			sign:             true,
+			expectedStatus:   http.StatusOK,
+			expectedResponse: "arn:aws:iam::123456789012:user/gopher hello",
+		},
+		{
+			name:             "unsigned requests are forbidden",
+			expectedStatus:   http.StatusForbidden,
+			expectedResponse: `{"message":"Forbidden"}`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			body := []byte("hello")
+			r, err := http.NewRequest(http.MethodPost, s.URL+"/path?a=1", bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			if tt.sign {
+				signRequest(r, body, creds, "us-east-1", "lambda", time.Now())
+			}
+
+			// Act.
+			resp, err := s.Client().Do(r)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			actual, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if string(actual) != tt.expectedResponse {
+				t.Errorf("expected %q, got %q", tt.expectedResponse, string(actual))
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+// Package invoke runs a http.Handler against API Gateway V2 event JSON files, for example, events captured
+// from production logs, and prints the decoded HTTP responses.
+//
+// There's no way to load an arbitrary handler into a command without Go plugins, so the handler's own
+// main package (or a test) calls Main or Run, e.g.:
+//
+//	if len(os.Args) > 1 && os.Args[1] == "invoke" {
+//		invoke.Main(http.DefaultServeMux, os.Args[2:])
+//	}
+//	awsapigatewayv2handler.ListenAndServe(http.DefaultServeMux)
+package invoke
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/a-h/awsapigatewayv2handler"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+// ErrMismatch is returned by Run when at least one response didn't match the expected response.
+var ErrMismatch = errors.New("invoke: response did not match expected response")
+
+// Main calls Run with the process's stdout and stderr, and exits with a non-zero status code on failure.
+func Main(h http.Handler, args []string, opts ...awsapigatewayv2handler.Option) {
+	if err := Run(context.Background(), h, args, os.Stdout, os.Stderr, opts...); err != nil {
+		if !errors.Is(err, ErrMismatch) && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+// Run invokes h with each event file (or glob) in args, and prints the decoded responses to stdout.
+//
+// If the -expected flag is a file, every response is compared to it. If it's a directory, each event is
+// compared to the file with the same name in that directory.
+//
+// The options configure the LambdaHandler, so they should match the ones the Lambda function uses.
+func Run(ctx context.Context, h http.Handler, args []string, stdout, stderr io.Writer, opts ...awsapigatewayv2handler.Option) (err error) {
+	flags := flag.NewFlagSet("invoke", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	expected := flags.String("expected", "", "Expected response JSON file, or directory of files named after each event file.")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: invoke [-expected <file|dir>] <event.json>...")
+		flags.PrintDefaults()
+	}
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+	eventFiles, err := expandGlobs(flags.Args())
+	if err != nil {
+		return err
+	}
+	if len(eventFiles) == 0 {
+		flags.Usage()
+		return errors.New("invoke: no event files specified")
+	}
+	expectedIsDir := false
+	if *expected != "" {
+		fi, err := os.Stat(*expected)
+		if err != nil {
+			return err
+		}
+		expectedIsDir = fi.IsDir()
+	}
+
+	lh := awsapigatewayv2handler.NewLambdaHandler(h, opts...)
+	var mismatched bool
+	for _, eventFile := range eventFiles {
+		fmt.Fprintf(stdout, "== %s\n", eventFile)
+		payload, err := os.ReadFile(eventFile)
+		if err != nil {
+			return err
+		}
+		respPayload, err := lh.Invoke(ctx, payload)
+		if err != nil {
+			return fmt.Errorf("invoke: %s: %w", eventFile, err)
+		}
+		var resp events.APIGatewayV2HTTPResponse
+		if err = json.Unmarshal(respPayload, &resp); err != nil {
+			return fmt.Errorf("invoke: %s: failed to decode response: %w", eventFile, err)
+		}
+		actual, err := decode(resp)
+		if err != nil {
+			return fmt.Errorf("invoke: %s: %w", eventFile, err)
+		}
+		Print(stdout, actual)
+		if *expected == "" {
+			continue
+		}
+		expectedFile := *expected
+		if expectedIsDir {
+			expectedFile = filepath.Join(*expected, filepath.Base(eventFile))
+		}
+		expectedResponse, err := readResponse(expectedFile)
+		if err != nil {
+			return fmt.Errorf("invoke: %s: failed to read expected response: %w", eventFile, err)
+		}
+		if diff := cmp.Diff(expectedResponse, actual); diff != "" {
+			mismatched = true
+			fmt.Fprintf(stdout, "-- response does not match %s (-expected +actual):\n%s\n", expectedFile, diff)
+			continue
+		}
+		fmt.Fprintf(stdout, "-- response matches %s\n\n", expectedFile)
+	}
+	if mismatched {
+		return ErrMismatch
+	}
+	return nil
+}
+
+func expandGlobs(patterns []string) (files []string, err error) {
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("invoke: no files match %q", pattern)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// Response is an API Gateway V2 response with the body decoded.
+type Response struct {
+	StatusCode int
+	Headers    map[string]string
+	Cookies    []string
+	Body       []byte
+}
+
+func readResponse(fileName string) (r Response, err error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return
+	}
+	var resp events.APIGatewayV2HTTPResponse
+	if err = json.Unmarshal(data, &resp); err != nil {
+		return
+	}
+	return decode(resp)
+}
+
+func decode(resp events.APIGatewayV2HTTPResponse) (r Response, err error) {
+	r.StatusCode = resp.StatusCode
+	r.Headers = resp.Headers
+	r.Cookies = resp.Cookies
+	r.Body = []byte(resp.Body)
+	if resp.IsBase64Encoded {
+		r.Body, err = base64.StdEncoding.DecodeString(resp.Body)
+		if err != nil {
+			return r, fmt.Errorf("failed to decode base64 body: %w", err)
+		}
+	}
+	return
+}
+
+// Print writes the response in a similar format to a HTTP/1.1 response. Binary bodies are summarised.
+func Print(w io.Writer, r Response) {
+	fmt.Fprintf(w, "%d %s\n", r.StatusCode, http.StatusText(r.StatusCode))
+	keys := make([]string, 0, len(r.Headers))
+	for k := range r.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s: %s\n", k, r.Headers[k])
+	}
+	for _, c := range r.Cookies {
+		fmt.Fprintf(w, "Set-Cookie: %s\n", c)
+	}
+	fmt.Fprintln(w)
+	if len(r.Body) == 0 {
+		return
+	}
+	if isBinary(r.Body) {
+		fmt.Fprintf(w, "<%d bytes of binary data>\n\n", len(r.Body))
+		return
+	}
+	w.Write(r.Body)
+	if !strings.HasSuffix(string(r.Body), "\n") {
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+}
+
+func isBinary(body []byte) bool {
+	contentType := http.DetectContentType(body)
+	return !strings.HasPrefix(contentType, "text/")
+}
@@ -0,0 +1,155 @@
+package invoke
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/a-h/awsapigatewayv2handler"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+var testHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/hello":
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		io.WriteString(w, "Hello, "+r.URL.Query().Get("name"))
+	case "/binary":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte{0, 1, 2, 3})
+	}
+})
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name          string
+		handler       http.Handler
+		opts          []awsapigatewayv2handler.Option
+		args          []string
+		expectedErr   error
+		expectedLines []string
+	}{
+		{
+			name:    "responses are printed",
+			handler: testHandler,
+			args:    []string{"testdata/events/hello.json"},
+			expectedLines: []string{
+				"== testdata/events/hello.json",
+				"200 OK",
+				"Content-Type: text/plain; charset=utf-8",
+				"Set-Cookie: session=abc",
+				"Hello, World",
+			},
+		},
+		{
+			name:    "options configure the Lambda handler",
+			handler: testHandler,
+			opts: []awsapigatewayv2handler.Option{
+				awsapigatewayv2handler.WithAfterResponse(func(ctx context.Context, e events.APIGatewayV2HTTPRequest, resp *events.APIGatewayV2HTTPResponse) error {
+					resp.Headers["X-Hook"] = "called"
+					return nil
+				}),
+			},
+			args: []string{"testdata/events/hello.json"},
+			expectedLines: []string{
+				"200 OK",
+				"X-Hook: called",
+			},
+		},
+		{
+			name:    "binary responses are summarised",
+			handler: testHandler,
+			args:    []string{"testdata/events/binary.json"},
+			expectedLines: []string{
+				"Content-Type: application/octet-stream",
+				"<4 bytes of binary data>",
+			},
+		},
+		{
+			name:    "globs expand to multiple events, and are compared to the expected directory",
+			handler: testHandler,
+			args:    []string{"-expected", "testdata/expected", "testdata/events/*.json"},
+			expectedLines: []string{
+				"== testdata/events/binary.json",
+				"-- response matches testdata/expected/binary.json",
+				"== testdata/events/hello.json",
+				"-- response matches testdata/expected/hello.json",
+			},
+		},
+		{
+			name:        "mismatches are reported",
+			handler:     http.NotFoundHandler(),
+			args:        []string{"-expected", "testdata/expected/hello.json", "testdata/events/hello.json"},
+			expectedErr: ErrMismatch,
+			expectedLines: []string{
+				"404 Not Found",
+				"-- response does not match testdata/expected/hello.json (-expected +actual):",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Arrange.
+			stdout := new(bytes.Buffer)
+			stderr := new(bytes.Buffer)
+
+			// Act.
+			err := Run(context.Background(), test.handler, test.args, stdout, stderr, test.opts...)
+
+			// Assert.
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+			}
+			lines := strings.Split(stdout.String(), "\n")
+			for _, expected := range test.expectedLines {
+				if !contains(lines, expected) {
+					t.Errorf("expected output to contain line %q, got:\n%s", expected, stdout.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRunWithoutEvents(t *testing.T) {
+	err := Run(context.Background(), testHandler, nil, io.Discard, io.Discard)
+	if err == nil {
+		t.Error("expected an error when no events are provided")
+	}
+}
+
+func TestPrint(t *testing.T) {
+	// Arrange.
+	w := new(bytes.Buffer)
+	r := Response{
+		StatusCode: http.StatusCreated,
+		Headers: map[string]string{
+			"X-B": "b",
+			"X-A": "a",
+		},
+		Cookies: []string{"a=b"},
+		Body:    []byte("{}\n"),
+	}
+
+	// Act.
+	Print(w, r)
+
+	// Assert.
+	expected := "201 Created\nX-A: a\nX-B: b\nSet-Cookie: a=b\n\n{}\n\n"
+	if diff := cmp.Diff(expected, w.String()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func contains(lines []string, s string) bool {
+	for _, l := range lines {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
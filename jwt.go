@@ -0,0 +1,449 @@
+package awsapigatewayv2handler
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTClaims are the claims of a validated JSON Web Token. Claims are formatted as strings in the same way
+// as the claims of an API Gateway JWT authorizer, e.g. arrays are formatted as "[a b c]".
+type JWTClaims struct {
+	Claims map[string]string
+	Scopes []string
+}
+
+type jwtClaimsContextKey struct{}
+
+// GetJWTClaims returns the claims of the JWT that authorized the request. The claims are validated by an
+// API Gateway JWT authorizer, or by a JWTHandler.
+func GetJWTClaims(ctx context.Context) (c JWTClaims, ok bool) {
+	if c, ok = ctx.Value(jwtClaimsContextKey{}).(JWTClaims); ok {
+		return
+	}
+	e, ok := GetEvent(ctx)
+	if !ok || e.RequestContext.Authorizer == nil || e.RequestContext.Authorizer.JWT == nil {
+		return c, false
+	}
+	return JWTClaims{
+		Claims: e.RequestContext.Authorizer.JWT.Claims,
+		Scopes: e.RequestContext.Authorizer.JWT.Scopes,
+	}, true
+}
+
+// JWKSFetcher returns a JSON Web Key Set document.
+type JWKSFetcher func(ctx context.Context) ([]byte, error)
+
+// jwksFetchTimeout limits how long requests wait for keys to be fetched.
+const jwksFetchTimeout = 10 * time.Second
+
+var jwksClient = &http.Client{Timeout: jwksFetchTimeout}
+
+// HTTPJWKSFetcher fetches a JSON Web Key Set document from a URL, e.g.
+// https://cognito-idp.eu-west-2.amazonaws.com/<user-pool-id>/.well-known/jwks.json
+func HTTPJWKSFetcher(url string) JWKSFetcher {
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := jwksClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+		}
+		return io.ReadAll(resp.Body)
+	}
+}
+
+// JWTOptions configures JWT validation.
+type JWTOptions struct {
+	// Issuer is the required iss claim.
+	Issuer string
+	// Audiences are the allowed values of the aud claim. If empty, the aud claim isn't checked.
+	Audiences []string
+	// Keys fetches the JSON Web Key Set used to verify token signatures.
+	Keys JWKSFetcher
+	// CacheDuration is how long keys are cached for. Defaults to 1 hour. Keys are fetched again if a token
+	// has an unknown key ID, or the last fetch failed, at most once a minute. Expired keys are used until
+	// they're fetched successfully.
+	CacheDuration time.Duration
+	// Leeway allows for clock skew when checking the exp and nbf claims.
+	Leeway time.Duration
+}
+
+// NewJWTHandler creates a handler that validates the bearer token in the Authorization header, before
+// calling next. Use GetJWTClaims to get the claims.
+//
+// Requests that have already been authorized by an API Gateway JWT authorizer aren't validated again, so
+// handlers work the same way whether the token was validated by API Gateway or the JWTHandler.
+func NewJWTHandler(opts JWTOptions, next http.Handler) *JWTHandler {
+	return &JWTHandler{
+		Options: opts,
+		Next:    next,
+	}
+}
+
+// JWTHandler validates JSON Web Tokens signed with the RS256, ES256 or EdDSA algorithms.
+type JWTHandler struct {
+	Options JWTOptions
+	Next    http.Handler
+
+	now         func() time.Time
+	m           sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	fetchErr    error
+	// fetching is closed when the fetch in progress completes.
+	fetching chan struct{}
+}
+
+func (h *JWTHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, ok := GetJWTClaims(r.Context()); ok {
+		h.Next.ServeHTTP(w, r)
+		return
+	}
+	// The authentication scheme is case-insensitive.
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeProblemDetails(w, http.StatusUnauthorized, "missing bearer token")
+		return
+	}
+	claims, err := h.Validate(r.Context(), token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeProblemDetails(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	h.Next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), jwtClaimsContextKey{}, claims)))
+}
+
+var errInvalidJWT = errors.New("invalid token")
+
+// Validate verifies the token's signature, and checks the iss, aud, exp and nbf claims.
+func (h *JWTHandler) Validate(ctx context.Context, token string) (c JWTClaims, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return c, errInvalidJWT
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err = decodeJWTSegment(parts[0], &header); err != nil {
+		return c, errInvalidJWT
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return c, errInvalidJWT
+	}
+	key, err := h.getKey(ctx, header.Kid)
+	if err != nil {
+		return c, err
+	}
+	if err = verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return c, err
+	}
+	var claims map[string]any
+	if err = decodeJWTSegment(parts[1], &claims); err != nil {
+		return c, errInvalidJWT
+	}
+	if err = h.checkClaims(claims); err != nil {
+		return c, err
+	}
+	return formatJWTClaims(claims), nil
+}
+
+func decodeJWTSegment(s string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	digest := sha256.Sum256(signed)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg == "RS256" && rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if alg == "ES256" && len(sig) == 64 {
+			r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			if ecdsa.Verify(k, digest[:], r, s) {
+				return nil
+			}
+		}
+	case ed25519.PublicKey:
+		if alg == "EdDSA" && ed25519.Verify(k, signed, sig) {
+			return nil
+		}
+	}
+	return errors.New("invalid token signature")
+}
+
+func (h *JWTHandler) currentTime() time.Time {
+	if h.now != nil {
+		return h.now()
+	}
+	return time.Now()
+}
+
+func (h *JWTHandler) cacheDuration() time.Duration {
+	if h.Options.CacheDuration == 0 {
+		return time.Hour
+	}
+	return h.Options.CacheDuration
+}
+
+func (h *JWTHandler) checkClaims(claims map[string]any) error {
+	now := h.currentTime()
+	if iss, _ := claims["iss"].(string); iss != h.Options.Issuer {
+		return fmt.Errorf("invalid token issuer %q", iss)
+	}
+	if len(h.Options.Audiences) > 0 && !hasAudience(claims["aud"], h.Options.Audiences) {
+		return errors.New("invalid token audience")
+	}
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if !now.Before(exp.Add(h.Options.Leeway)) {
+		return errors.New("token has expired")
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(h.Options.Leeway).Before(nbf) {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
+
+func hasAudience(aud any, allowed []string) bool {
+	var values []string
+	switch v := aud.(type) {
+	case string:
+		values = []string{v}
+	case []any:
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	for _, v := range values {
+		for _, a := range allowed {
+			if v == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func numericDate(v any) (t time.Time, ok bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return t, false
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true
+}
+
+// formatJWTClaims formats claims in the same way as an API Gateway JWT authorizer. Scopes are read from
+// the scope or scp claims.
+func formatJWTClaims(claims map[string]any) (c JWTClaims) {
+	c.Claims = make(map[string]string, len(claims))
+	for k, v := range claims {
+		c.Claims[k] = formatJWTClaim(v)
+	}
+	for _, k := range []string{"scope", "scp"} {
+		switch v := claims[k].(type) {
+		case string:
+			c.Scopes = strings.Fields(v)
+		case []any:
+			for _, s := range v {
+				c.Scopes = append(c.Scopes, formatJWTClaim(s))
+			}
+		}
+		if len(c.Scopes) > 0 {
+			break
+		}
+	}
+	return
+}
+
+func formatJWTClaim(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case []any:
+		values := make([]string, len(v))
+		for i, vv := range v {
+			values[i] = formatJWTClaim(vv)
+		}
+		return "[" + strings.Join(values, " ") + "]"
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// jwksRefetchInterval limits how often keys are fetched when tokens have unknown key IDs.
+const jwksRefetchInterval = time.Minute
+
+func (h *JWTHandler) getKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	h.m.Lock()
+	// Wait for any fetch in progress, rather than fetching the keys again.
+	for h.fetching != nil {
+		fetching := h.fetching
+		h.m.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		h.m.Lock()
+	}
+	now := h.currentTime()
+	key, ok := h.keys[kid]
+	expired := now.Sub(h.fetchedAt) > h.cacheDuration()
+	if ok && !expired {
+		h.m.Unlock()
+		return key, nil
+	}
+	if now.Sub(h.attemptedAt) < jwksRefetchInterval {
+		err := h.fetchErr
+		h.m.Unlock()
+		// Expired keys are used until they can be fetched again.
+		if ok {
+			return key, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unknown token key ID %q", kid)
+	}
+	fetching := make(chan struct{})
+	h.fetching, h.attemptedAt = fetching, now
+	h.m.Unlock()
+
+	// The fetch isn't cancelled with the request, since other requests may be waiting for it.
+	keys, err := h.fetchKeys(context.WithoutCancel(ctx))
+
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.fetching, h.fetchErr = nil, err
+	close(fetching)
+	if err != nil {
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+	h.keys, h.fetchedAt = keys, now
+	if key, ok = h.keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown token key ID %q", kid)
+	}
+	return key, nil
+}
+
+func (h *JWTHandler) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, jwksFetchTimeout)
+	defer cancel()
+	data, err := h.Options.Keys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch keys: %w", err)
+	}
+	return parseJWKS(data)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS parses the RSA, P-256 and Ed25519 keys of a JSON Web Key Set. Other keys, and RSA keys shorter
+// than 2048 bits, are ignored.
+func parseJWKS(data []byte) (keys map[string]crypto.PublicKey, err error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+	keys = make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWKS key %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) *big.Int {
+		b, _ := base64.RawURLEncoding.DecodeString(s)
+		return new(big.Int).SetBytes(b)
+	}
+	switch {
+	case k.Kty == "RSA":
+		n, e := decode(k.N), decode(k.E)
+		if n.Sign() == 0 || !e.IsInt64() || e.Int64() < 3 {
+			return nil, errors.New("invalid RSA key")
+		}
+		// Short keys are ignored, so that tokens signed with them are rejected.
+		if n.BitLen() < 2048 {
+			return nil, nil
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: decode(k.X), Y: decode(k.Y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("invalid EC key")
+		}
+		return key, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
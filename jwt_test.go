@@ -0,0 +1,507 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+type testJWTKey struct {
+	kid     string
+	private crypto.Signer
+}
+
+func (k testJWTKey) jwk() map[string]string {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch pub := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": k.kid, "n": enc(pub.N.Bytes()), "e": enc(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": k.kid, "crv": "P-256", "x": enc(pub.X.FillBytes(make([]byte, 32))), "y": enc(pub.Y.FillBytes(make([]byte, 32)))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": k.kid, "crv": "Ed25519", "x": enc(pub)}
+	}
+	panic("unknown key type")
+}
+
+func (k testJWTKey) sign(t *testing.T, alg string, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": k.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	var err error
+	switch key := k.private.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		if err == nil {
+			sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(key, []byte(signed))
+	}
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func newTestJWTKeys(t *testing.T) (rsaKey, ecKey, edKey testJWTKey) {
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+	_, dk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	return testJWTKey{kid: "rsa", private: rk}, testJWTKey{kid: "ec", private: ek}, testJWTKey{kid: "ed", private: dk}
+}
+
+func testJWKS(keys ...testJWTKey) JWKSFetcher {
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for _, k := range keys {
+		jwks.Keys = append(jwks.Keys, k.jwk())
+	}
+	data, _ := json.Marshal(jwks)
+	return func(ctx context.Context) ([]byte, error) {
+		return data, nil
+	}
+}
+
+func TestJWTHandler(t *testing.T) {
+	rsaKey, ecKey, edKey := newTestJWTKeys(t)
+	_, _, otherKey := newTestJWTKeys(t)
+	otherKey.kid = "ed"
+	wk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	weakKey := testJWTKey{kid: "weak", private: wk}
+	now := time.Date(2022, time.July, 1, 12, 0, 0, 0, time.UTC)
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":   "https://issuer.example.com",
+			"aud":   []string{"api", "other"},
+			"sub":   "user-1",
+			"exp":   now.Add(time.Hour).Unix(),
+			"nbf":   now.Add(-time.Minute).Unix(),
+			"scope": "orders:read orders:write",
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+	expectedClaims := JWTClaims{
+		Claims: map[string]string{
+			"iss":   "https://issuer.example.com",
+			"aud":   "[api other]",
+			"sub":   "user-1",
+			"exp":   "1656680400",
+			"nbf":   "1656676740",
+			"scope": "orders:read orders:write",
+		},
+		Scopes: []string{"orders:read", "orders:write"},
+	}
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+		expectedClaims JWTClaims
+	}{
+		{
+			name:           "RS256 tokens are valid",
+			authorization:  "Bearer " + rsaKey.sign(t, "RS256", claims(nil)),
+			expectedStatus: http.StatusOK,
+			expectedClaims: expectedClaims,
+		},
+		{
+			name:           "ES256 tokens are valid",
+			authorization:  "Bearer " + ecKey.sign(t, "ES256", claims(nil)),
+			expectedStatus: http.StatusOK,
+			expectedClaims: expectedClaims,
+		},
+		{
+			name:           "EdDSA tokens are valid",
+			authorization:  "Bearer " + edKey.sign(t, "EdDSA", claims(nil)),
+			expectedStatus: http.StatusOK,
+			expectedClaims: expectedClaims,
+		},
+		{
+			name:           "the bearer scheme is case-insensitive",
+			authorization:  "bearer " + rsaKey.sign(t, "RS256", claims(nil)),
+			expectedStatus: http.StatusOK,
+			expectedClaims: expectedClaims,
+		},
+		{
+			name:           "other schemes are unauthorized",
+			authorization:  "Basic dXNlcjpwYXNz",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "a token signed by an RSA key shorter than 2048 bits is unauthorized",
+			authorization:  "Bearer " + weakKey.sign(t, "RS256", claims(nil)),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "a missing token is unauthorized",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "a malformed token is unauthorized",
+			authorization:  "Bearer abc.def",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "a token signed by another key is unauthorized",
+			authorization:  "Bearer " + otherKey.sign(t, "EdDSA", claims(nil)),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "a token with a mismatched algorithm is unauthorized",
+			authorization:  "Bearer " + edKey.sign(t, "RS256", claims(nil)),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "a token with an unknown key ID is unauthorized",
+			authorization:  "Bearer " + testJWTKey{kid: "unknown", private: edKey.private}.sign(t, "EdDSA", claims(nil)),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "a token from another issuer is unauthorized",
+			authorization:  "Bearer " + rsaKey.sign(t, "RS256", claims(map[string]any{"iss": "https://other.example.com"})),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "a token for another audience is unauthorized",
+			authorization:  "Bearer " + rsaKey.sign(t, "RS256", claims(map[string]any{"aud": "other"})),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "an expired token is unauthorized",
+			authorization:  "Bearer " + rsaKey.sign(t, "RS256", claims(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()})),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "a recently expired token is within the leeway",
+			authorization:  "Bearer " + rsaKey.sign(t, "RS256", claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix(), "scope": nil})),
+			expectedStatus: http.StatusOK,
+			expectedClaims: JWTClaims{
+				Claims: map[string]string{
+					"iss": "https://issuer.example.com",
+					"aud": "[api other]",
+					"sub": "user-1",
+					"exp": "1656676770",
+					"nbf": "1656676740",
+				},
+			},
+		},
+		{
+			name:           "a token without an expiry is unauthorized",
+			authorization:  "Bearer " + rsaKey.sign(t, "RS256", claims(map[string]any{"exp": nil})),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "a token that isn't valid yet is unauthorized",
+			authorization:  "Bearer " + rsaKey.sign(t, "RS256", claims(map[string]any{"nbf": now.Add(2 * time.Minute).Unix()})),
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			var actualClaims JWTClaims
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actualClaims, _ = GetJWTClaims(r.Context())
+			})
+			h := NewJWTHandler(JWTOptions{
+				Issuer:    "https://issuer.example.com",
+				Audiences: []string{"api"},
+				Keys:      testJWKS(rsaKey, ecKey, edKey, weakKey),
+				Leeway:    time.Minute,
+			}, next)
+			h.now = func() time.Time { return now }
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			// Act.
+			h.ServeHTTP(w, r)
+
+			// Assert.
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header")
+			}
+			if diff := cmp.Diff(tt.expectedClaims, actualClaims); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestJWTHandlerAuthorizerClaims(t *testing.T) {
+	// Arrange.
+	var actual JWTClaims
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actual, _ = GetJWTClaims(r.Context())
+	})
+	keys := func(ctx context.Context) ([]byte, error) {
+		t.Error("unexpected key fetch")
+		return nil, errors.New("unexpected key fetch")
+	}
+	lh := NewLambdaHandler(NewJWTHandler(JWTOptions{Issuer: "https://issuer.example.com", Keys: keys}, next))
+	e := events.APIGatewayV2HTTPRequest{RawPath: "/"}
+	e.RequestContext.Authorizer = &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+		JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{
+			Claims: map[string]string{"sub": "user-1"},
+			Scopes: []string{"orders:read"},
+		},
+	}
+
+	// Act.
+	resp, err := lh.Handle(context.Background(), e)
+
+	// Assert.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+	expected := JWTClaims{Claims: map[string]string{"sub": "user-1"}, Scopes: []string{"orders:read"}}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestJWTHandlerKeyCache(t *testing.T) {
+	// Arrange.
+	rsaKey, _, edKey := newTestJWTKeys(t)
+	now := time.Date(2022, time.July, 1, 12, 0, 0, 0, time.UTC)
+	var fetches int
+	jwks := testJWKS(rsaKey)
+	keys := func(ctx context.Context) ([]byte, error) {
+		fetches++
+		return jwks(ctx)
+	}
+	h := NewJWTHandler(JWTOptions{Keys: keys, CacheDuration: time.Hour}, http.NotFoundHandler())
+	h.now = func() time.Time { return now }
+	validate := func(key testJWTKey, alg string) error {
+		_, err := h.Validate(context.Background(), key.sign(t, alg, map[string]any{"exp": now.Add(24 * time.Hour).Unix()}))
+		return err
+	}
+
+	// Act and assert.
+	for i := 0; i < 2; i++ {
+		if err := validate(rsaKey, "RS256"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("expected keys to be cached, got %d fetches", fetches)
+	}
+	// Unknown keys don't cause a fetch within the refetch interval.
+	if err := validate(edKey, "EdDSA"); err == nil {
+		t.Error("expected unknown key error")
+	}
+	if fetches != 1 {
+		t.Errorf("expected no refetch within a minute, got %d fetches", fetches)
+	}
+	// After the refetch interval, the keys are fetched again.
+	jwks = testJWKS(rsaKey, edKey)
+	now = now.Add(2 * time.Minute)
+	if err := validate(edKey, "EdDSA"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if fetches != 2 {
+		t.Errorf("expected keys to be refetched, got %d fetches", fetches)
+	}
+	// Keys are fetched again when the cache expires.
+	now = now.Add(2 * time.Hour)
+	if err := validate(rsaKey, "RS256"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if fetches != 3 {
+		t.Errorf("expected cache to expire, got %d fetches", fetches)
+	}
+}
+
+func TestJWTHandlerKeyFetchFailures(t *testing.T) {
+	// Arrange.
+	rsaKey, _, _ := newTestJWTKeys(t)
+	now := time.Date(2022, time.July, 1, 12, 0, 0, 0, time.UTC)
+	var fetches int
+	fetchErr := errors.New("unavailable")
+	keys := func(ctx context.Context) ([]byte, error) {
+		fetches++
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return testJWKS(rsaKey)(ctx)
+	}
+	h := NewJWTHandler(JWTOptions{Keys: keys}, http.NotFoundHandler())
+	h.now = func() time.Time { return now }
+	validate := func() error {
+		_, err := h.Validate(context.Background(), rsaKey.sign(t, "RS256", map[string]any{"exp": now.Add(24 * time.Hour).Unix()}))
+		return err
+	}
+
+	// Act and assert.
+	for i := 0; i < 2; i++ {
+		if err := validate(); !errors.Is(err, fetchErr) {
+			t.Errorf("expected fetch error, got %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("expected failed fetches not to be retried within a minute, got %d fetches", fetches)
+	}
+	fetchErr = nil
+	now = now.Add(2 * time.Minute)
+	if err := validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if fetches != 2 {
+		t.Errorf("expected keys to be refetched, got %d fetches", fetches)
+	}
+}
+
+func TestJWTHandlerExpiredKeys(t *testing.T) {
+	// Arrange.
+	rsaKey, _, _ := newTestJWTKeys(t)
+	now := time.Date(2022, time.July, 1, 12, 0, 0, 0, time.UTC)
+	var fetches int
+	var fetchErr error
+	keys := func(ctx context.Context) ([]byte, error) {
+		fetches++
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return testJWKS(rsaKey)(ctx)
+	}
+	h := NewJWTHandler(JWTOptions{Keys: keys, CacheDuration: 30 * time.Second}, http.NotFoundHandler())
+	h.now = func() time.Time { return now }
+	validate := func() error {
+		_, err := h.Validate(context.Background(), rsaKey.sign(t, "RS256", map[string]any{"exp": now.Add(24 * time.Hour).Unix()}))
+		return err
+	}
+	if err := validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Act and assert.
+	now = now.Add(45 * time.Second)
+	if err := validate(); err != nil {
+		t.Errorf("expected expired keys to be used until they can be refetched, got %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	fetchErr = errors.New("unavailable")
+	for i := 0; i < 2; i++ {
+		if err := validate(); err != nil {
+			t.Errorf("expected expired keys to be used when the fetch fails, got %v", err)
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("expected 2 fetches, got %d", fetches)
+	}
+}
+
+func TestJWTHandlerStructLiteral(t *testing.T) {
+	// Arrange.
+	rsaKey, _, _ := newTestJWTKeys(t)
+	h := &JWTHandler{
+		Options: JWTOptions{Keys: testJWKS(rsaKey)},
+		Next:    http.NotFoundHandler(),
+	}
+
+	// Act.
+	_, err := h.Validate(context.Background(), rsaKey.sign(t, "RS256", map[string]any{"exp": time.Now().Add(time.Hour).Unix()}))
+
+	// Assert.
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestJWTHandlerConcurrentKeyFetch(t *testing.T) {
+	// Arrange.
+	rsaKey, _, _ := newTestJWTKeys(t)
+	now := time.Date(2022, time.July, 1, 12, 0, 0, 0, time.UTC)
+	var fetches atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	keys := func(ctx context.Context) ([]byte, error) {
+		if fetches.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return testJWKS(rsaKey)(ctx)
+	}
+	h := NewJWTHandler(JWTOptions{Keys: keys}, http.NotFoundHandler())
+	h.now = func() time.Time { return now }
+	token := rsaKey.sign(t, "RS256", map[string]any{"exp": now.Add(24 * time.Hour).Unix()})
+
+	// Act.
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := h.Validate(context.Background(), token)
+			errs <- err
+		}()
+	}
+	<-started
+	// Requests can be cancelled while they wait for the keys.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, cancelledErr := h.Validate(ctx, token)
+	close(release)
+
+	// Assert.
+	if !errors.Is(cancelledErr, context.Canceled) {
+		t.Errorf("expected cancelled request to return, got %v", cancelledErr)
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("expected a single fetch, got %d", n)
+	}
+}
@@ -0,0 +1,132 @@
+package awsapigatewayv2handler
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// MetricDimension is a property of the API Gateway event that metrics are grouped by.
+type MetricDimension string
+
+const (
+	DimensionRouteKey MetricDimension = "RouteKey"
+	DimensionStage    MetricDimension = "Stage"
+	DimensionMethod   MetricDimension = "Method"
+)
+
+// WithMetrics writes CloudWatch Embedded Metric Format (EMF) JSON to w after every invocation. The
+// metrics of each invocation are written as a single line. If w is nil, os.Stdout is used, which Lambda
+// sends to CloudWatch Logs, where the metrics are extracted.
+//
+// The Latency, RequestBytes, ResponseBytes, ColdStart, 2xx, 3xx, 4xx and 5xx metrics are recorded,
+// grouped by the dimensions.
+//
+// See https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch_Embedded_Metric_Format_Specification.html
+func WithMetrics(w io.Writer, namespace string, dimensions ...MetricDimension) Option {
+	return func(lh *LambdaHandler) {
+		if w == nil {
+			w = os.Stdout
+		}
+		lh.metrics = &metricsConfig{
+			w:          w,
+			namespace:  namespace,
+			dimensions: dimensions,
+		}
+	}
+}
+
+type metricsConfig struct {
+	w          io.Writer
+	namespace  string
+	dimensions []MetricDimension
+}
+
+type emfMetadata struct {
+	Timestamp         int64                `json:"Timestamp"`
+	CloudWatchMetrics []emfMetricDirective `json:"CloudWatchMetrics"`
+}
+
+type emfMetricDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]MetricDimension   `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+type emfMetricDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+var emfMetrics = []emfMetricDefinition{
+	{Name: "Latency", Unit: "Milliseconds"},
+	{Name: "RequestBytes", Unit: "Bytes"},
+	{Name: "ResponseBytes", Unit: "Bytes"},
+	{Name: "ColdStart", Unit: "Count"},
+	{Name: "2xx", Unit: "Count"},
+	{Name: "3xx", Unit: "Count"},
+	{Name: "4xx", Unit: "Count"},
+	{Name: "5xx", Unit: "Count"},
+}
+
+func (mc *metricsConfig) write(e events.APIGatewayV2HTTPRequest, resp events.APIGatewayV2HTTPResponse, responseBytes int, err error, start time.Time, duration time.Duration, coldStart bool) error {
+	dimensions := mc.dimensions
+	if dimensions == nil {
+		dimensions = []MetricDimension{}
+	}
+	m := map[string]any{
+		"_aws": emfMetadata{
+			Timestamp: start.UnixMilli(),
+			CloudWatchMetrics: []emfMetricDirective{
+				{
+					Namespace:  mc.namespace,
+					Dimensions: [][]MetricDimension{dimensions},
+					Metrics:    emfMetrics,
+				},
+			},
+		},
+		"Latency":       float64(duration) / float64(time.Millisecond),
+		"RequestBytes":  bodyLength(e.Body, e.IsBase64Encoded),
+		"ResponseBytes": responseBytes,
+		"ColdStart":     boolToCount(coldStart),
+	}
+	for _, d := range dimensions {
+		m[string(d)] = dimensionValue(e, d)
+	}
+	status := resp.StatusCode
+	if err != nil {
+		// API Gateway returns a 500 error if the Lambda function returns an error.
+		status = 500
+	}
+	for _, class := range []string{"2xx", "3xx", "4xx", "5xx"} {
+		m[class] = boolToCount(status/100 == int(class[0]-'0'))
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = mc.w.Write(append(data, '\n'))
+	return err
+}
+
+func dimensionValue(e events.APIGatewayV2HTTPRequest, d MetricDimension) string {
+	switch d {
+	case DimensionRouteKey:
+		return e.RouteKey
+	case DimensionStage:
+		return e.RequestContext.Stage
+	case DimensionMethod:
+		return e.RequestContext.HTTP.Method
+	}
+	return ""
+}
+
+func boolToCount(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,164 @@
+package awsapigatewayv2handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetrics(t *testing.T) {
+	event := events.APIGatewayV2HTTPRequest{
+		RouteKey: "POST /orders",
+		RawPath:  "/orders",
+		Body:     "AAECAw==",
+		Headers: map[string]string{
+			"content-type": "application/octet-stream",
+		},
+		IsBase64Encoded: true,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			Stage: "prod",
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method: http.MethodPost,
+			},
+		},
+	}
+	metrics := []any{
+		map[string]any{"Name": "Latency", "Unit": "Milliseconds"},
+		map[string]any{"Name": "RequestBytes", "Unit": "Bytes"},
+		map[string]any{"Name": "ResponseBytes", "Unit": "Bytes"},
+		map[string]any{"Name": "ColdStart", "Unit": "Count"},
+		map[string]any{"Name": "2xx", "Unit": "Count"},
+		map[string]any{"Name": "3xx", "Unit": "Count"},
+		map[string]any{"Name": "4xx", "Unit": "Count"},
+		map[string]any{"Name": "5xx", "Unit": "Count"},
+	}
+	tests := []struct {
+		name       string
+		handler    http.Handler
+		opts       []Option
+		dimensions []MetricDimension
+		expected   map[string]any
+	}{
+		{
+			name: "metrics are grouped by the dimensions",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, "created")
+			}),
+			dimensions: []MetricDimension{DimensionRouteKey, DimensionStage, DimensionMethod},
+			expected: map[string]any{
+				"_aws": map[string]any{
+					"CloudWatchMetrics": []any{
+						map[string]any{
+							"Namespace":  "orders",
+							"Dimensions": []any{[]any{"RouteKey", "Stage", "Method"}},
+							"Metrics":    metrics,
+						},
+					},
+				},
+				"RouteKey":      "POST /orders",
+				"Stage":         "prod",
+				"Method":        "POST",
+				"RequestBytes":  float64(4),
+				"ResponseBytes": float64(7),
+				"2xx":           float64(1),
+				"3xx":           float64(0),
+				"4xx":           float64(0),
+				"5xx":           float64(0),
+			},
+		},
+		{
+			name:    "metrics can have no dimensions",
+			handler: http.NotFoundHandler(),
+			expected: map[string]any{
+				"_aws": map[string]any{
+					"CloudWatchMetrics": []any{
+						map[string]any{
+							"Namespace":  "orders",
+							"Dimensions": []any{[]any{}},
+							"Metrics":    metrics,
+						},
+					},
+				},
+				"RequestBytes":  float64(4),
+				"ResponseBytes": float64(19),
+				"2xx":           float64(0),
+				"3xx":           float64(0),
+				"4xx":           float64(1),
+				"5xx":           float64(0),
+			},
+		},
+		{
+			name:    "errors are counted as 5xx responses",
+			handler: http.NotFoundHandler(),
+			opts: []Option{
+				WithBeforeRequest(func(ctx context.Context, e *events.APIGatewayV2HTTPRequest) error {
+					return errors.New("rejected")
+				}),
+			},
+			dimensions: []MetricDimension{DimensionMethod},
+			expected: map[string]any{
+				"_aws": map[string]any{
+					"CloudWatchMetrics": []any{
+						map[string]any{
+							"Namespace":  "orders",
+							"Dimensions": []any{[]any{"Method"}},
+							"Metrics":    metrics,
+						},
+					},
+				},
+				"Method":        "POST",
+				"RequestBytes":  float64(4),
+				"ResponseBytes": float64(0),
+				"2xx":           float64(0),
+				"3xx":           float64(0),
+				"4xx":           float64(0),
+				"5xx":           float64(1),
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			var buf bytes.Buffer
+			lh := NewLambdaHandler(tt.handler, append(tt.opts, WithMetrics(&buf, "orders", tt.dimensions...))...)
+
+			// Act.
+			lh.Handle(context.Background(), event)
+
+			// Assert.
+			if lines := strings.Count(buf.String(), "\n"); lines != 1 {
+				t.Fatalf("expected metrics to be written as a single line, got %d lines", lines)
+			}
+			var actual map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &actual); err != nil {
+				t.Fatalf("failed to parse metrics %q: %v", buf.String(), err)
+			}
+			// Remove the values that vary between runs.
+			if _, ok := actual["_aws"].(map[string]any)["Timestamp"].(float64); !ok {
+				t.Error("expected a timestamp")
+			}
+			delete(actual["_aws"].(map[string]any), "Timestamp")
+			if _, ok := actual["Latency"].(float64); !ok {
+				t.Error("expected latency")
+			}
+			delete(actual, "Latency")
+			if _, ok := actual["ColdStart"].(float64); !ok {
+				t.Error("expected cold start")
+			}
+			delete(actual, "ColdStart")
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+// Package otel creates an OpenTelemetry server span for each API Gateway V2 invocation of a
+// awsapigatewayv2handler.LambdaHandler.
+//
+//	lh := awsapigatewayv2handler.NewLambdaHandler(mux)
+//	lambda.StartHandler(otel.NewHandler(lh))
+package otel
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/a-h/awsapigatewayv2handler"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/a-h/awsapigatewayv2handler/otel"
+
+// Option configures the Handler.
+type Option func(h *Handler)
+
+// WithTracerProvider sets the tracer provider. The global tracer provider is used by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(h *Handler) {
+		h.tracerProvider = tp
+	}
+}
+
+// WithPropagator sets the propagator used to extract the parent span from the request headers. The
+// global propagator is used by default.
+//
+// The Lambda runtime's X-Ray trace header replaces any X-Amzn-Trace-Id request header, so using the
+// X-Ray propagator continues the trace started by Lambda.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(h *Handler) {
+		h.propagator = p
+	}
+}
+
+// Flusher exports any buffered spans, e.g. *sdktrace.TracerProvider.
+type Flusher interface {
+	ForceFlush(ctx context.Context) error
+}
+
+// WithFlusher flushes spans at the end of each invocation. The Lambda execution environment is frozen
+// between invocations, so spans that are buffered, e.g. by a batch span processor, may not be exported
+// until the next invocation, or at all.
+func WithFlusher(f Flusher) Option {
+	return func(h *Handler) {
+		h.flusher = f
+	}
+}
+
+// NewHandler wraps the LambdaHandler to create a server span for each invocation.
+func NewHandler(lh awsapigatewayv2handler.LambdaHandler, opts ...Option) Handler {
+	h := Handler{
+		tracerProvider: otel.GetTracerProvider(),
+		propagator:     otel.GetTextMapPropagator(),
+	}
+	for _, o := range opts {
+		o(&h)
+	}
+	h.tracer = h.tracerProvider.Tracer(instrumentationName)
+	awsapigatewayv2handler.WithObserver(h.observe)(&lh)
+	h.lh = lh
+	return h
+}
+
+// Handler is a Lambda handler that creates a server span for each invocation.
+type Handler struct {
+	lh             awsapigatewayv2handler.LambdaHandler
+	tracerProvider trace.TracerProvider
+	tracer         trace.Tracer
+	propagator     propagation.TextMapPropagator
+	flusher        Flusher
+}
+
+func (h Handler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	if h.flusher != nil {
+		defer h.flusher.ForceFlush(ctx)
+	}
+	return h.lh.Invoke(ctx, payload)
+}
+
+func (h Handler) Handle(ctx context.Context, e events.APIGatewayV2HTTPRequest) (resp events.APIGatewayV2HTTPResponse, err error) {
+	if h.flusher != nil {
+		defer h.flusher.ForceFlush(ctx)
+	}
+	return h.lh.Handle(ctx, e)
+}
+
+// observe starts the span when the LambdaHandler starts to handle the event, and ends it with the response.
+func (h Handler) observe(ctx context.Context, e events.APIGatewayV2HTTPRequest) (context.Context, func(events.APIGatewayV2HTTPResponse, int, error)) {
+	ctx = h.propagator.Extract(ctx, carrier(ctx, e))
+	ctx, span := h.tracer.Start(ctx, spanName(e), trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(requestAttributes(ctx, e)...))
+	return ctx, func(resp events.APIGatewayV2HTTPResponse, responseBytes int, err error) {
+		defer span.End()
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return
+		}
+		span.SetAttributes(
+			semconv.HTTPResponseStatusCode(resp.StatusCode),
+			semconv.HTTPResponseBodySize(responseBytes),
+		)
+		if resp.StatusCode >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+		}
+	}
+}
+
+// carrier returns the request headers, with the X-Ray trace header of the Lambda runtime, if present.
+func carrier(ctx context.Context, e events.APIGatewayV2HTTPRequest) propagation.MapCarrier {
+	c := make(propagation.MapCarrier, len(e.Headers)+1)
+	for k, v := range e.Headers {
+		c[strings.ToLower(k)] = v
+	}
+	if s, _ := ctx.Value("x-amzn-trace-id").(string); s != "" {
+		c["x-amzn-trace-id"] = s
+	}
+	return c
+}
+
+func spanName(e events.APIGatewayV2HTTPRequest) string {
+	if e.RouteKey == "" || e.RouteKey == "$default" {
+		return e.RequestContext.HTTP.Method
+	}
+	return e.RouteKey
+}
+
+func requestAttributes(ctx context.Context, e events.APIGatewayV2HTTPRequest) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.FaaSTriggerHTTP,
+		semconv.HTTPRequestMethodKey.String(e.RequestContext.HTTP.Method),
+		semconv.URLPath(e.RawPath),
+		semconv.URLScheme("https"),
+	}
+	// Route keys are made up of the method and the route, e.g. "GET /orders/{id}".
+	if _, route, ok := strings.Cut(e.RouteKey, " "); ok {
+		attrs = append(attrs, semconv.HTTPRoute(route))
+	}
+	if e.RawQueryString != "" {
+		attrs = append(attrs, semconv.URLQuery(e.RawQueryString))
+	}
+	if e.RequestContext.HTTP.SourceIP != "" {
+		attrs = append(attrs, semconv.ClientAddress(e.RequestContext.HTTP.SourceIP))
+	}
+	if e.RequestContext.HTTP.UserAgent != "" {
+		attrs = append(attrs, semconv.UserAgentOriginal(e.RequestContext.HTTP.UserAgent))
+	}
+	if e.RequestContext.DomainName != "" {
+		attrs = append(attrs, semconv.ServerAddress(e.RequestContext.DomainName))
+	}
+	invocationID := e.RequestContext.RequestID
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		invocationID = lc.AwsRequestID
+	}
+	if invocationID != "" {
+		attrs = append(attrs, semconv.FaaSInvocationID(invocationID))
+	}
+	if inv, ok := awsapigatewayv2handler.GetInvocation(ctx); ok {
+		attrs = append(attrs, semconv.FaaSColdstart(inv.ColdStart))
+	}
+	return attrs
+}
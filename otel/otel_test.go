@@ -0,0 +1,235 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/a-h/awsapigatewayv2handler"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHandler(t *testing.T) {
+	event := events.APIGatewayV2HTTPRequest{
+		RouteKey:       "GET /orders/{id}",
+		RawPath:        "/orders/123",
+		RawQueryString: "expand=items",
+		Headers: map[string]string{
+			"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		},
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RequestID:  "request-id",
+			DomainName: "api.example.com",
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    http.MethodGet,
+				SourceIP:  "192.0.2.1",
+				UserAgent: "curl/7.79.1",
+			},
+		},
+	}
+	t.Run("a server span is created for each invocation", func(t *testing.T) {
+		// Arrange.
+		sr := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+		var handlerSpan trace.SpanContext
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerSpan = trace.SpanContextFromContext(r.Context())
+			io.WriteString(w, "Hello")
+		})
+		handler := NewHandler(awsapigatewayv2handler.NewLambdaHandler(h), WithTracerProvider(tp), WithPropagator(propagation.TraceContext{}))
+
+		// Act.
+		_, err := handler.Handle(context.Background(), event)
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		spans := sr.Ended()
+		if len(spans) != 1 {
+			t.Fatalf("expected 1 span, got %d", len(spans))
+		}
+		span := spans[0]
+		if span.Name() != "GET /orders/{id}" {
+			t.Errorf("expected span name %q, got %q", "GET /orders/{id}", span.Name())
+		}
+		if span.SpanKind() != trace.SpanKindServer {
+			t.Errorf("expected server span, got %v", span.SpanKind())
+		}
+		if actual := span.Parent().TraceID().String(); actual != "0af7651916cd43dd8448eb211c80319c" {
+			t.Errorf("expected parent trace ID to be propagated, got %q", actual)
+		}
+		if handlerSpan.SpanID() != span.SpanContext().SpanID() {
+			t.Errorf("expected the span to be in the request context")
+		}
+		expected := map[attribute.Key]attribute.Value{
+			"faas.trigger":              attribute.StringValue("http"),
+			"http.request.method":       attribute.StringValue("GET"),
+			"http.route":                attribute.StringValue("/orders/{id}"),
+			"url.path":                  attribute.StringValue("/orders/123"),
+			"url.query":                 attribute.StringValue("expand=items"),
+			"url.scheme":                attribute.StringValue("https"),
+			"client.address":            attribute.StringValue("192.0.2.1"),
+			"user_agent.original":       attribute.StringValue("curl/7.79.1"),
+			"server.address":            attribute.StringValue("api.example.com"),
+			"faas.invocation_id":        attribute.StringValue("request-id"),
+			"http.response.status_code": attribute.IntValue(200),
+			"http.response.body.size":   attribute.IntValue(5),
+		}
+		actual := map[attribute.Key]attribute.Value{}
+		for _, kv := range span.Attributes() {
+			actual[kv.Key] = kv.Value
+		}
+		if _, ok := actual["faas.coldstart"]; !ok {
+			t.Error("expected faas.coldstart attribute")
+		}
+		delete(actual, "faas.coldstart")
+		if diff := cmp.Diff(expected, actual, cmp.AllowUnexported(attribute.Value{})); diff != "" {
+			t.Error(diff)
+		}
+	})
+	t.Run("the Lambda request ID is used as the invocation ID", func(t *testing.T) {
+		// Arrange.
+		sr := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+		handler := NewHandler(awsapigatewayv2handler.NewLambdaHandler(http.NotFoundHandler()), WithTracerProvider(tp))
+		ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "lambda-request-id"})
+
+		// Act.
+		handler.Handle(ctx, event)
+
+		// Assert.
+		for _, kv := range sr.Ended()[0].Attributes() {
+			if kv.Key == "faas.invocation_id" && kv.Value.AsString() != "lambda-request-id" {
+				t.Errorf("expected lambda-request-id, got %q", kv.Value.AsString())
+			}
+		}
+	})
+	t.Run("spans can be flushed after each invocation", func(t *testing.T) {
+		// Arrange.
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+		handler := NewHandler(awsapigatewayv2handler.NewLambdaHandler(http.NotFoundHandler()), WithTracerProvider(tp), WithFlusher(tp))
+
+		// Act.
+		handler.Handle(context.Background(), event)
+
+		// Assert.
+		if spans := exporter.GetSpans(); len(spans) != 1 {
+			t.Errorf("expected 1 exported span, got %d", len(spans))
+		}
+	})
+	t.Run("server errors set the span status", func(t *testing.T) {
+		// Arrange.
+		sr := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "failed", http.StatusBadGateway)
+		})
+		handler := NewHandler(awsapigatewayv2handler.NewLambdaHandler(h), WithTracerProvider(tp))
+
+		// Act.
+		handler.Handle(context.Background(), event)
+
+		// Assert.
+		if status := sr.Ended()[0].Status(); status.Code != codes.Error {
+			t.Errorf("expected error status, got %v", status)
+		}
+	})
+	t.Run("errors are recorded", func(t *testing.T) {
+		// Arrange.
+		sr := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+		lh := awsapigatewayv2handler.NewLambdaHandler(http.NotFoundHandler(),
+			awsapigatewayv2handler.WithBeforeRequest(func(ctx context.Context, e *events.APIGatewayV2HTTPRequest) error {
+				return errors.New("rejected")
+			}))
+		handler := NewHandler(lh, WithTracerProvider(tp))
+
+		// Act.
+		_, err := handler.Handle(context.Background(), event)
+
+		// Assert.
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		span := sr.Ended()[0]
+		if status := span.Status(); status.Code != codes.Error || status.Description != "rejected" {
+			t.Errorf("expected error status, got %v", status)
+		}
+		if len(span.Events()) != 1 || span.Events()[0].Name != "exception" {
+			t.Errorf("expected exception event, got %v", span.Events())
+		}
+	})
+	t.Run("binary responses are streamed by Invoke", func(t *testing.T) {
+		// Arrange.
+		sr := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G'})
+		})
+		handler := NewHandler(awsapigatewayv2handler.NewLambdaHandler(h), WithTracerProvider(tp))
+
+		// Act.
+		resp, err := handler.Invoke(context.Background(), []byte(`{"rawPath":"/","requestContext":{"http":{"method":"GET"}}}`))
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(string(resp), `"body":"iVBORw==","isBase64Encoded":true`) {
+			t.Errorf("expected base64 body, got %s", resp)
+		}
+		for _, kv := range sr.Ended()[0].Attributes() {
+			if kv.Key == "http.response.body.size" && kv.Value.AsInt64() != 4 {
+				t.Errorf("expected body size 4, got %d", kv.Value.AsInt64())
+			}
+		}
+	})
+	t.Run("CORS preflight spans have the cold start attribute", func(t *testing.T) {
+		// Arrange.
+		sr := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+		lh := awsapigatewayv2handler.NewLambdaHandler(http.NotFoundHandler(),
+			awsapigatewayv2handler.WithCORS(awsapigatewayv2handler.CORSOptions{AllowedOrigins: []string{"*"}}))
+		handler := NewHandler(lh, WithTracerProvider(tp))
+		preflight := events.APIGatewayV2HTTPRequest{
+			RawPath: "/orders",
+			Headers: map[string]string{
+				"origin":                        "https://example.com",
+				"access-control-request-method": "POST",
+			},
+		}
+		preflight.RequestContext.HTTP.Method = http.MethodOptions
+
+		// Act.
+		resp, err := handler.Handle(context.Background(), preflight)
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("expected preflight response, got status %d", resp.StatusCode)
+		}
+		var found bool
+		for _, kv := range sr.Ended()[0].Attributes() {
+			found = found || kv.Key == "faas.coldstart"
+		}
+		if !found {
+			t.Error("expected faas.coldstart attribute")
+		}
+	})
+}
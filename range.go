@@ -0,0 +1,185 @@
+package awsapigatewayv2handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// WithRanges serves byte ranges of successful GET responses, so that downloads can be resumed. Since
+// responses are buffered, ranges can be served for any handler. Responses that already have a
+// Content-Range header, or an Accept-Ranges header of none, are unchanged.
+func WithRanges() Option {
+	return func(lh *LambdaHandler) {
+		lh.ranges = true
+	}
+}
+
+func rangeResponse(r *http.Request, rec *httptest.ResponseRecorder) *httptest.ResponseRecorder {
+	if r.Method != http.MethodGet {
+		return rec
+	}
+	result := rec.Result()
+	if result.StatusCode != http.StatusOK || len(result.Trailer) > 0 ||
+		result.Header.Get("Content-Range") != "" || result.Header.Get("Accept-Ranges") == "none" {
+		return rec
+	}
+	body := rec.Body.Bytes()
+	size := int64(len(body))
+	if result.ContentLength > -1 && result.ContentLength != size {
+		return rec
+	}
+	w := httptest.NewRecorder()
+	for k, v := range result.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	ranges, err := parseRange(r.Header.Get("Range"), size)
+	if errors.Is(err, errNoOverlap) && ifRangeMatches(r, result.Header) {
+		w.Header().Del("Content-Type")
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return w
+	}
+	// Invalid ranges are ignored, as are ranges that are larger than the body, since they'd be more
+	// expensive to send than the whole body.
+	if err != nil || len(ranges) == 0 || sumRangesSize(ranges) > size || !ifRangeMatches(r, result.Header) {
+		w.Body = rec.Body
+		w.WriteHeader(http.StatusOK)
+		return w
+	}
+	if len(ranges) == 1 {
+		ra := ranges[0]
+		w.Header().Set("Content-Range", ra.contentRange(size))
+		w.Header().Set("Content-Length", strconv.FormatInt(ra.length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(body[ra.start : ra.start+ra.length])
+		return w
+	}
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	contentType := result.Header.Get("Content-Type")
+	for _, ra := range ranges {
+		header := textproto.MIMEHeader{"Content-Range": {ra.contentRange(size)}}
+		if contentType != "" {
+			header.Set("Content-Type", contentType)
+		}
+		part, _ := mw.CreatePart(header)
+		part.Write(body[ra.start : ra.start+ra.length])
+	}
+	mw.Close()
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Body = &buf
+	return w
+}
+
+// ifRangeMatches returns true if the response matches the If-Range header, or there isn't one.
+// See https://www.rfc-editor.org/rfc/rfc9110#section-13.1.5
+func ifRangeMatches(r *http.Request, header http.Header) bool {
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, `"`) || strings.HasPrefix(ir, "W/") {
+		// If-Range requires a strong comparison.
+		etag := header.Get("ETag")
+		return !strings.HasPrefix(ir, "W/") && !strings.HasPrefix(etag, "W/") && ir == etag
+	}
+	t, err := http.ParseTime(ir)
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && lastModified.Equal(t)
+}
+
+type httpRange struct {
+	start, length int64
+}
+
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+var errNoOverlap = errors.New("invalid range: failed to overlap")
+
+// parseRange parses a Range header, e.g. "bytes=0-499, -500". It returns no ranges if the header is empty.
+func parseRange(s string, size int64) ([]httpRange, error) {
+	if s == "" {
+		return nil, nil
+	}
+	const b = "bytes="
+	if !strings.HasPrefix(s, b) {
+		return nil, errors.New("invalid range")
+	}
+	var ranges []httpRange
+	var noOverlap bool
+	for _, ra := range strings.Split(s[len(b):], ",") {
+		ra = strings.TrimSpace(ra)
+		if ra == "" {
+			continue
+		}
+		start, end, ok := strings.Cut(ra, "-")
+		if !ok {
+			return nil, errors.New("invalid range")
+		}
+		start, end = strings.TrimSpace(start), strings.TrimSpace(end)
+		var r httpRange
+		if start == "" {
+			// A suffix range, e.g. -500 is the last 500 bytes.
+			if end == "" || end[0] == '-' {
+				return nil, errors.New("invalid range")
+			}
+			i, err := strconv.ParseInt(end, 10, 64)
+			if i < 0 || err != nil {
+				return nil, errors.New("invalid range")
+			}
+			if i == 0 {
+				noOverlap = true
+				continue
+			}
+			r.start = max(size-i, 0)
+			r.length = size - r.start
+		} else {
+			i, err := strconv.ParseInt(start, 10, 64)
+			if err != nil || i < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if i >= size {
+				noOverlap = true
+				continue
+			}
+			r.start = i
+			if end == "" {
+				r.length = size - r.start
+			} else {
+				i, err := strconv.ParseInt(end, 10, 64)
+				if err != nil || r.start > i {
+					return nil, errors.New("invalid range")
+				}
+				r.length = min(i, size-1) - r.start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if noOverlap && len(ranges) == 0 {
+		return nil, errNoOverlap
+	}
+	return ranges, nil
+}
+
+func sumRangesSize(ranges []httpRange) (size int64) {
+	for _, ra := range ranges {
+		size += ra.length
+	}
+	return
+}
@@ -0,0 +1,333 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRanges(t *testing.T) {
+	const lastModified = "Wed, 21 Oct 2015 07:28:00 GMT"
+	tests := []struct {
+		name            string
+		opts            []Option
+		method          string
+		headers         map[string]string
+		handlerHeaders  map[string]string
+		expectedStatus  int
+		expectedHeaders map[string]string
+		expectedBody    string
+	}{
+		{
+			name:           "ranges aren't served by default",
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "bytes=0-3"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Content-Type": "text/plain",
+			},
+			expectedBody: "0123456789",
+		},
+		{
+			name:           "responses without a Range header advertise range support",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges": "bytes",
+				"Content-Type":  "text/plain",
+			},
+			expectedBody: "0123456789",
+		},
+		{
+			name:           "a range can be requested",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "bytes=0-3"},
+			expectedStatus: http.StatusPartialContent,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Content-Length": "4",
+				"Content-Range":  "bytes 0-3/10",
+				"Content-Type":   "text/plain",
+			},
+			expectedBody: "0123",
+		},
+		{
+			name:           "the end of the range is optional",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "bytes=7-"},
+			expectedStatus: http.StatusPartialContent,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Content-Length": "3",
+				"Content-Range":  "bytes 7-9/10",
+				"Content-Type":   "text/plain",
+			},
+			expectedBody: "789",
+		},
+		{
+			name:           "the last bytes can be requested",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "bytes=-3"},
+			expectedStatus: http.StatusPartialContent,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Content-Length": "3",
+				"Content-Range":  "bytes 7-9/10",
+				"Content-Type":   "text/plain",
+			},
+			expectedBody: "789",
+		},
+		{
+			name:           "ranges past the end of the body are truncated",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "bytes=5-100"},
+			expectedStatus: http.StatusPartialContent,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Content-Length": "5",
+				"Content-Range":  "bytes 5-9/10",
+				"Content-Type":   "text/plain",
+			},
+			expectedBody: "56789",
+		},
+		{
+			name:           "ranges that start after the end of the body can't be satisfied",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "bytes=20-"},
+			expectedStatus: http.StatusRequestedRangeNotSatisfiable,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges": "bytes",
+				"Content-Range": "bytes */10",
+			},
+		},
+		{
+			name:           "invalid ranges are ignored",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "items=0-3"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges": "bytes",
+				"Content-Type":  "text/plain",
+			},
+			expectedBody: "0123456789",
+		},
+		{
+			name:           "ranges larger than the body are ignored",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "bytes=0-8,1-9"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges": "bytes",
+				"Content-Type":  "text/plain",
+			},
+			expectedBody: "0123456789",
+		},
+		{
+			name:           "ranges are served if If-Range matches the ETag",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "bytes=0-3", "If-Range": `"v1"`},
+			handlerHeaders: map[string]string{"ETag": `"v1"`},
+			expectedStatus: http.StatusPartialContent,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Content-Length": "4",
+				"Content-Range":  "bytes 0-3/10",
+				"Content-Type":   "text/plain",
+				"Etag":           `"v1"`,
+			},
+			expectedBody: "0123",
+		},
+		{
+			name:           "ranges are served if If-Range matches Last-Modified",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "bytes=0-3", "If-Range": lastModified},
+			handlerHeaders: map[string]string{"Last-Modified": lastModified},
+			expectedStatus: http.StatusPartialContent,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Content-Length": "4",
+				"Content-Range":  "bytes 0-3/10",
+				"Content-Type":   "text/plain",
+				"Last-Modified":  lastModified,
+			},
+			expectedBody: "0123",
+		},
+		{
+			name:           "the whole body is served if If-Range doesn't match",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "bytes=0-3", "If-Range": `"v1"`},
+			handlerHeaders: map[string]string{"ETag": `"v2"`},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges": "bytes",
+				"Content-Type":  "text/plain",
+				"Etag":          `"v2"`,
+			},
+			expectedBody: "0123456789",
+		},
+		{
+			name:           "If-Range requires a strong ETag",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "bytes=0-3", "If-Range": `W/"v1"`},
+			handlerHeaders: map[string]string{"ETag": `W/"v1"`},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges": "bytes",
+				"Content-Type":  "text/plain",
+				"Etag":          `W/"v1"`,
+			},
+			expectedBody: "0123456789",
+		},
+		{
+			name:           "POST responses are unchanged",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodPost,
+			headers:        map[string]string{"Range": "bytes=0-3"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Content-Type": "text/plain",
+			},
+			expectedBody: "0123456789",
+		},
+		{
+			name:           "responses with a Content-Range header are unchanged",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "bytes=0-3"},
+			handlerHeaders: map[string]string{"Content-Range": "bytes 0-9/20"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Content-Range": "bytes 0-9/20",
+				"Content-Type":  "text/plain",
+			},
+			expectedBody: "0123456789",
+		},
+		{
+			name:           "handlers can disable ranges",
+			opts:           []Option{WithRanges()},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Range": "bytes=0-3"},
+			handlerHeaders: map[string]string{"Accept-Ranges": "none"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges": "none",
+				"Content-Type":  "text/plain",
+			},
+			expectedBody: "0123456789",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				for k, v := range tt.handlerHeaders {
+					w.Header().Set(k, v)
+				}
+				io.WriteString(w, "0123456789")
+			})
+			lh := NewLambdaHandler(h, tt.opts...)
+			e := events.APIGatewayV2HTTPRequest{
+				RawPath: "/",
+				Headers: tt.headers,
+			}
+			e.RequestContext.HTTP.Method = tt.method
+
+			// Act.
+			resp, err := lh.Handle(context.Background(), e)
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if diff := cmp.Diff(tt.expectedHeaders, resp.Headers); diff != "" {
+				t.Error(diff)
+			}
+			if resp.Body != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, resp.Body)
+			}
+		})
+	}
+	t.Run("multiple ranges are returned as multipart/byteranges", func(t *testing.T) {
+		// Arrange.
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			io.WriteString(w, "0123456789")
+		})
+		lh := NewLambdaHandler(h, WithRanges())
+		e := events.APIGatewayV2HTTPRequest{
+			RawPath: "/",
+			Headers: map[string]string{"Range": "bytes=0-1, 5-6"},
+		}
+		e.RequestContext.HTTP.Method = http.MethodGet
+
+		// Act.
+		resp, err := lh.Handle(context.Background(), e)
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			t.Errorf("expected status %d, got %d", http.StatusPartialContent, resp.StatusCode)
+		}
+		mediaType, params, err := mime.ParseMediaType(resp.Headers["Content-Type"])
+		if err != nil || mediaType != "multipart/byteranges" {
+			t.Fatalf("expected multipart/byteranges, got %q", resp.Headers["Content-Type"])
+		}
+		body, err := base64.StdEncoding.DecodeString(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to decode body: %v", err)
+		}
+		type part struct {
+			ContentType  string
+			ContentRange string
+			Body         string
+		}
+		var actual []part
+		mr := multipart.NewReader(strings.NewReader(string(body)), params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("failed to read part: %v", err)
+			}
+			data, _ := io.ReadAll(p)
+			actual = append(actual, part{p.Header.Get("Content-Type"), p.Header.Get("Content-Range"), string(data)})
+		}
+		expected := []part{
+			{"application/octet-stream", "bytes 0-1/10", "01"},
+			{"application/octet-stream", "bytes 5-6/10", "56"},
+		}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Error(diff)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package awsapigatewayv2handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// WithOnShutdown registers a function to call when the Lambda execution environment shuts down, e.g. to
+// flush telemetry or close database connections. The context's deadline is the end of the shutdown
+// phase. Shutdown functions are called concurrently.
+//
+// Shutdown functions are only called if ListenAndServe, Start or ListenForShutdown is used.
+func WithOnShutdown(f func(ctx context.Context)) Option {
+	return func(lh *LambdaHandler) {
+		lh.RegisterOnShutdown(f)
+	}
+}
+
+// RegisterOnShutdown registers a function to call when the Lambda execution environment shuts down.
+func (lh *LambdaHandler) RegisterOnShutdown(f func(ctx context.Context)) {
+	lh.onShutdown = append(lh.onShutdown, f)
+}
+
+// Start listens for shutdown, if any shutdown functions are registered, and starts the Lambda handler.
+// It never returns.
+func (lh LambdaHandler) Start() {
+	if len(lh.onShutdown) > 0 {
+		if err := lh.ListenForShutdown(); err != nil {
+			fmt.Fprintf(os.Stderr, "awsapigatewayv2handler: shutdown functions will not be called: %v\n", err)
+		}
+	}
+	lambda.StartHandler(lh)
+}
+
+// ListenForShutdown registers an internal Lambda extension, which causes Lambda to send a SIGTERM signal
+// to the process before the execution environment is shut down. When the signal is received, the
+// registered shutdown functions are called, and the process exits.
+//
+// ListenForShutdown must be called before the Lambda handler is started. It's only required if the Lambda
+// handler is started with lambda.Start or lambda.StartHandler instead of ListenAndServe or Start.
+func (lh LambdaHandler) ListenForShutdown() error {
+	runtimeAPI := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if runtimeAPI == "" {
+		return errors.New("AWS_LAMBDA_RUNTIME_API environment variable not set")
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	sl := shutdownListener{
+		runtimeAPI: runtimeAPI,
+		client:     http.DefaultClient,
+		signals:    signals,
+		callbacks:  lh.onShutdown,
+		exit:       os.Exit,
+	}
+	return sl.listen(context.Background())
+}
+
+// When an internal extension is registered, the runtime has 500ms to shut down.
+// See https://docs.aws.amazon.com/lambda/latest/dg/lambda-runtime-environment.html#runtimes-lifecycle-shutdown
+const shutdownGracePeriod = 500 * time.Millisecond
+
+type shutdownListener struct {
+	runtimeAPI string
+	client     *http.Client
+	signals    <-chan os.Signal
+	callbacks  []func(ctx context.Context)
+	exit       func(code int)
+	once       sync.Once
+}
+
+type extensionEvent struct {
+	EventType      string `json:"eventType"`
+	DeadlineMs     int64  `json:"deadlineMs"`
+	ShutdownReason string `json:"shutdownReason"`
+}
+
+func (sl *shutdownListener) listen(ctx context.Context) error {
+	id, err := sl.register(ctx)
+	if err != nil {
+		return err
+	}
+	// Extensions must request the next event to signal that they've initialized. Internal extensions
+	// can't register for the SHUTDOWN event, but it's handled in case that changes.
+	go func() {
+		for {
+			e, err := sl.next(ctx, id)
+			if err != nil {
+				return
+			}
+			if e.EventType == "SHUTDOWN" {
+				sl.shutdown(time.UnixMilli(e.DeadlineMs))
+				return
+			}
+		}
+	}()
+	go func() {
+		if _, ok := <-sl.signals; ok {
+			sl.shutdown(time.Now().Add(shutdownGracePeriod))
+		}
+	}()
+	return nil
+}
+
+func (sl *shutdownListener) register(ctx context.Context) (id string, err error) {
+	body, err := json.Marshal(map[string][]string{"events": {}})
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+sl.runtimeAPI+"/2020-01-01/extension/register", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Lambda-Extension-Name", "awsapigatewayv2handler")
+	resp, err := sl.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to register extension: status %d", resp.StatusCode)
+	}
+	return resp.Header.Get("Lambda-Extension-Identifier"), nil
+}
+
+func (sl *shutdownListener) next(ctx context.Context, id string) (e extensionEvent, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+sl.runtimeAPI+"/2020-01-01/extension/event/next", nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Lambda-Extension-Identifier", id)
+	resp, err := sl.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return e, fmt.Errorf("failed to get next extension event: status %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&e)
+	return
+}
+
+func (sl *shutdownListener) shutdown(deadline time.Time) {
+	sl.once.Do(func() {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		var wg sync.WaitGroup
+		for _, f := range sl.callbacks {
+			wg.Add(1)
+			go func(f func(ctx context.Context)) {
+				defer wg.Done()
+				f(ctx)
+			}(f)
+		}
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		sl.exit(0)
+	})
+}
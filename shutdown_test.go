@@ -0,0 +1,191 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type fakeExtensionsAPI struct {
+	*httptest.Server
+	registeredName   string
+	registeredEvents []string
+	nextEvents       chan extensionEvent
+}
+
+func newFakeExtensionsAPI(t *testing.T, registerStatus int) *fakeExtensionsAPI {
+	api := &fakeExtensionsAPI{
+		nextEvents: make(chan extensionEvent, 1),
+	}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2020-01-01/extension/register":
+			api.registeredName = r.Header.Get("Lambda-Extension-Name")
+			var body struct {
+				Events []string `json:"events"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("failed to decode registration: %v", err)
+			}
+			api.registeredEvents = body.Events
+			w.Header().Set("Lambda-Extension-Identifier", "extension-id")
+			w.WriteHeader(registerStatus)
+		case "/2020-01-01/extension/event/next":
+			if id := r.Header.Get("Lambda-Extension-Identifier"); id != "extension-id" {
+				t.Errorf("unexpected extension ID %q", id)
+			}
+			select {
+			case e := <-api.nextEvents:
+				json.NewEncoder(w).Encode(e)
+			case <-r.Context().Done():
+			}
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+// newTestContext returns a context that's cancelled before the fake API is closed, to stop the long poll
+// for the next event.
+func newTestContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func newTestShutdownListener(api *fakeExtensionsAPI, signals chan os.Signal, callbacks ...func(ctx context.Context)) (sl *shutdownListener, exited chan int) {
+	exited = make(chan int, 1)
+	sl = &shutdownListener{
+		runtimeAPI: strings.TrimPrefix(api.URL, "http://"),
+		client:     api.Client(),
+		signals:    signals,
+		callbacks:  callbacks,
+		exit: func(code int) {
+			exited <- code
+		},
+	}
+	return
+}
+
+func TestShutdownListener(t *testing.T) {
+	t.Run("an internal extension is registered", func(t *testing.T) {
+		// Arrange.
+		api := newFakeExtensionsAPI(t, http.StatusOK)
+		ctx := newTestContext(t)
+		sl, _ := newTestShutdownListener(api, make(chan os.Signal))
+
+		// Act.
+		err := sl.listen(ctx)
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if api.registeredName != "awsapigatewayv2handler" {
+			t.Errorf("unexpected extension name %q", api.registeredName)
+		}
+		if len(api.registeredEvents) != 0 {
+			t.Errorf("expected internal extension not to register for events, got %v", api.registeredEvents)
+		}
+	})
+	t.Run("registration failures are returned", func(t *testing.T) {
+		api := newFakeExtensionsAPI(t, http.StatusForbidden)
+		ctx := newTestContext(t)
+		sl, _ := newTestShutdownListener(api, make(chan os.Signal))
+		if err := sl.listen(ctx); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+	t.Run("SIGTERM calls the shutdown functions and exits", func(t *testing.T) {
+		// Arrange.
+		api := newFakeExtensionsAPI(t, http.StatusOK)
+		ctx := newTestContext(t)
+		signals := make(chan os.Signal, 1)
+		deadlines := make(chan time.Time, 2)
+		f := func(ctx context.Context) {
+			deadline, _ := ctx.Deadline()
+			deadlines <- deadline
+		}
+		sl, exited := newTestShutdownListener(api, signals, f, f)
+		if err := sl.listen(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Act.
+		start := time.Now()
+		signals <- syscall.SIGTERM
+
+		// Assert.
+		if code := <-exited; code != 0 {
+			t.Errorf("expected exit code 0, got %d", code)
+		}
+		if len(deadlines) != 2 {
+			t.Fatalf("expected both shutdown functions to be called, got %d", len(deadlines))
+		}
+		if deadline := <-deadlines; deadline.Before(start) || deadline.After(time.Now().Add(shutdownGracePeriod)) {
+			t.Errorf("expected deadline within %v, got %v", shutdownGracePeriod, deadline.Sub(start))
+		}
+	})
+	t.Run("SHUTDOWN events use the event deadline", func(t *testing.T) {
+		// Arrange.
+		api := newFakeExtensionsAPI(t, http.StatusOK)
+		ctx := newTestContext(t)
+		deadlines := make(chan time.Time, 1)
+		sl, exited := newTestShutdownListener(api, make(chan os.Signal), func(ctx context.Context) {
+			deadline, _ := ctx.Deadline()
+			deadlines <- deadline
+		})
+		if err := sl.listen(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expectedDeadline := time.Now().Add(2 * time.Second).Truncate(time.Millisecond)
+
+		// Act.
+		api.nextEvents <- extensionEvent{EventType: "SHUTDOWN", ShutdownReason: "spindown", DeadlineMs: expectedDeadline.UnixMilli()}
+
+		// Assert.
+		<-exited
+		if deadline := <-deadlines; !deadline.Equal(expectedDeadline) {
+			t.Errorf("expected deadline %v, got %v", expectedDeadline, deadline)
+		}
+	})
+	t.Run("slow shutdown functions don't delay exit past the deadline", func(t *testing.T) {
+		// Arrange.
+		api := newFakeExtensionsAPI(t, http.StatusOK)
+		ctx := newTestContext(t)
+		signals := make(chan os.Signal, 1)
+		sl, exited := newTestShutdownListener(api, signals, func(ctx context.Context) {
+			time.Sleep(time.Minute)
+		})
+		if err := sl.listen(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Act.
+		signals <- syscall.SIGTERM
+
+		// Assert.
+		select {
+		case <-exited:
+		case <-time.After(shutdownGracePeriod * 2):
+			t.Error("expected exit at the deadline")
+		}
+	})
+}
+
+func TestWithOnShutdown(t *testing.T) {
+	lh := NewLambdaHandler(http.NotFoundHandler(), WithOnShutdown(func(ctx context.Context) {}))
+	lh.RegisterOnShutdown(func(ctx context.Context) {})
+	if len(lh.onShutdown) != 2 {
+		t.Errorf("expected 2 shutdown functions, got %d", len(lh.onShutdown))
+	}
+}
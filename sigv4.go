@@ -0,0 +1,273 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Credentials are AWS credentials used to sign requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsProvider returns AWS credentials.
+type CredentialsProvider func(ctx context.Context) (Credentials, error)
+
+// EnvironmentCredentials reads credentials from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables, which are set by the Lambda runtime.
+func EnvironmentCredentials(ctx context.Context) (c Credentials, err error) {
+	c.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	c.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	c.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		err = errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables must be set")
+	}
+	return
+}
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4DateFormat = "20060102"
+	// unsignedPayload is the X-Amz-Content-Sha256 value of requests that don't sign the body.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// signRequest adds AWS Signature Version 4 headers to the request.
+func signRequest(r *http.Request, body []byte, creds Credentials, region, service string, now time.Time) {
+	now = now.UTC()
+	r.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	if creds.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = hashHex(body)
+	}
+	signedHeaders := []string{"host", "x-amz-date"}
+	for k := range r.Header {
+		k = strings.ToLower(k)
+		if k == "content-type" || k == "x-amz-content-sha256" || k == "x-amz-security-token" {
+			signedHeaders = append(signedHeaders, k)
+		}
+	}
+	sort.Strings(signedHeaders)
+	scope := strings.Join([]string{now.Format(sigV4DateFormat), region, service, "aws4_request"}, "/")
+	cr := canonicalRequest(r, signedHeaders, payloadHash)
+	sts := stringToSign(now.Format(sigV4TimeFormat), scope, cr)
+	sig := signature(creds.SecretAccessKey, now.Format(sigV4DateFormat), region, service, sts)
+	r.Header.Set("Authorization", sigV4Algorithm+" Credential="+creds.AccessKeyID+"/"+scope+", SignedHeaders="+strings.Join(signedHeaders, ";")+", Signature="+sig)
+}
+
+// CredentialLookupFunc returns the secret access key, and the IAM identity, of an access key ID.
+type CredentialLookupFunc func(ctx context.Context, accessKeyID string) (secretAccessKey string, iam events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription, err error)
+
+// SigV4Verifier verifies AWS Signature Version 4 signed requests, to emulate AWS_IAM authorization of
+// function URLs and API Gateway routes when running locally.
+type SigV4Verifier struct {
+	// Lookup returns the secret access key of an access key ID.
+	Lookup CredentialLookupFunc
+	// Region and Service are checked against the credential scope of the signature, if set. Function URLs
+	// use the "lambda" service, and API Gateway uses "execute-api".
+	Region  string
+	Service string
+	// MaxSkew is the maximum difference between the signature time and the current time. Defaults to 5
+	// minutes.
+	MaxSkew time.Duration
+	// AllowUnsignedPayload accepts requests with an X-Amz-Content-Sha256 header of UNSIGNED-PAYLOAD, so
+	// the body isn't verified.
+	AllowUnsignedPayload bool
+
+	now func() time.Time
+}
+
+// ErrInvalidSignature is returned when a request isn't signed, or the signature is invalid.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Verify checks the signature of the request and body, and returns the IAM identity of the signer.
+func (v SigV4Verifier) Verify(r *http.Request, body []byte) (iam events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription, err error) {
+	if v.Lookup == nil {
+		return iam, errors.New("SigV4Verifier Lookup must be set")
+	}
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+	maxSkew := v.MaxSkew
+	if maxSkew == 0 {
+		maxSkew = 5 * time.Minute
+	}
+	credential, signedHeaders, sig, ok := parseSigV4Authorization(r.Header.Get("Authorization"))
+	if !ok {
+		return iam, ErrInvalidSignature
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse(sigV4TimeFormat, amzDate)
+	if err != nil {
+		return iam, ErrInvalidSignature
+	}
+	if d := now.Sub(signedAt); d > maxSkew || d < -maxSkew {
+		return iam, fmt.Errorf("%w: signature time is too far from the current time", ErrInvalidSignature)
+	}
+	// The credential is made up of the access key ID and the scope, e.g. AKID/20150830/us-east-1/service/aws4_request
+	credentialParts := strings.Split(credential, "/")
+	if len(credentialParts) != 5 || credentialParts[1] != signedAt.Format(sigV4DateFormat) || credentialParts[4] != "aws4_request" {
+		return iam, fmt.Errorf("%w: invalid credential scope", ErrInvalidSignature)
+	}
+	accessKeyID, date, region, service := credentialParts[0], credentialParts[1], credentialParts[2], credentialParts[3]
+	if (v.Region != "" && region != v.Region) || (v.Service != "" && service != v.Service) {
+		return iam, fmt.Errorf("%w: invalid credential scope", ErrInvalidSignature)
+	}
+	if !sortedContains(signedHeaders, "host") {
+		return iam, fmt.Errorf("%w: host header must be signed", ErrInvalidSignature)
+	}
+	payloadHash := hashHex(body)
+	if h := r.Header.Get("X-Amz-Content-Sha256"); h != "" && h != payloadHash {
+		if h != unsignedPayload || !v.AllowUnsignedPayload {
+			return iam, fmt.Errorf("%w: X-Amz-Content-Sha256 doesn't match the body", ErrInvalidSignature)
+		}
+		payloadHash = h
+	}
+	secretAccessKey, iam, err := v.Lookup(r.Context(), accessKeyID)
+	if err != nil {
+		return iam, err
+	}
+	cr := canonicalRequest(r, signedHeaders, payloadHash)
+	sts := stringToSign(amzDate, strings.Join(credentialParts[1:], "/"), cr)
+	expected := signature(secretAccessKey, date, region, service, sts)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription{}, ErrInvalidSignature
+	}
+	if iam.AccessKey == "" {
+		iam.AccessKey = accessKeyID
+	}
+	return iam, nil
+}
+
+func parseSigV4Authorization(header string) (credential string, signedHeaders []string, sig string, ok bool) {
+	params, ok := strings.CutPrefix(header, sigV4Algorithm+" ")
+	if !ok {
+		return
+	}
+	for _, param := range strings.Split(params, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch k {
+		case "Credential":
+			credential = v
+		case "SignedHeaders":
+			signedHeaders = strings.Split(v, ";")
+		case "Signature":
+			sig = v
+		}
+	}
+	ok = credential != "" && len(signedHeaders) > 0 && sig != "" && sort.StringsAreSorted(signedHeaders)
+	return
+}
+
+func sortedContains(values []string, s string) bool {
+	i := sort.SearchStrings(values, s)
+	return i < len(values) && values[i] == s
+}
+
+func canonicalRequest(r *http.Request, signedHeaders []string, payloadHash string) string {
+	var sb strings.Builder
+	sb.WriteString(r.Method)
+	sb.WriteByte('\n')
+	sb.WriteString(uriEncode(r.URL.EscapedPath(), false))
+	sb.WriteByte('\n')
+	sb.WriteString(canonicalQuery(r))
+	sb.WriteByte('\n')
+	for _, k := range signedHeaders {
+		sb.WriteString(k)
+		sb.WriteByte(':')
+		sb.WriteString(canonicalHeaderValue(r, k))
+		sb.WriteByte('\n')
+	}
+	sb.WriteByte('\n')
+	sb.WriteString(strings.Join(signedHeaders, ";"))
+	sb.WriteByte('\n')
+	sb.WriteString(payloadHash)
+	return sb.String()
+}
+
+func canonicalQuery(r *http.Request) string {
+	q := r.URL.Query()
+	pairs := make([]string, 0, len(q))
+	for k, v := range q {
+		for _, vv := range v {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(vv, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func canonicalHeaderValue(r *http.Request, name string) string {
+	values := r.Header.Values(name)
+	if name == "host" {
+		host := r.Host
+		if host == "" {
+			host = r.URL.Host
+		}
+		values = []string{host}
+	}
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(trimmed, ",")
+}
+
+func stringToSign(amzDate, scope, canonicalRequest string) string {
+	return sigV4Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonicalRequest))
+}
+
+func signature(secretAccessKey, date, region, service, stringToSign string) string {
+	k := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	k = hmacSHA256(k, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(k, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// uriEncode encodes all characters except the unreserved characters defined in RFC 3986, as required by
+// Signature Version 4. Slashes are only encoded if encodeSlash is true.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexChars = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(hexChars[c>>4])
+		sb.WriteByte(hexChars[c&15])
+	}
+	return sb.String()
+}
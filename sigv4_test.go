@@ -0,0 +1,243 @@
+package awsapigatewayv2handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSignRequest(t *testing.T) {
+	// Test cases from the AWS Signature Version 4 test suite.
+	creds := Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{
+			name:     "get-vanilla",
+			url:      "https://example.amazonaws.com/",
+			expected: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:     "get-vanilla-query-order-key-case",
+			url:      "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			expected: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, test.url, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			signRequest(r, nil, creds, "us-east-1", "service", now)
+			if actual := r.Header.Get("Authorization"); actual != test.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestURIEncode(t *testing.T) {
+	tests := []struct {
+		input       string
+		encodeSlash bool
+		expected    string
+	}{
+		{"/@connections/L0SM9cOFvHcCIhw=", false, "/%40connections/L0SM9cOFvHcCIhw%3D"},
+		{"a b/c", true, "a%20b%2Fc"},
+		{"-_.~", true, "-_.~"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			if actual := uriEncode(test.input, test.encodeSlash); actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSigV4Verifier(t *testing.T) {
+	creds := Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	lookup := func(ctx context.Context, accessKeyID string) (string, events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription, error) {
+		if accessKeyID != creds.AccessKeyID {
+			return "", events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription{}, errors.New("unknown access key")
+		}
+		return creds.SecretAccessKey, events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription{
+			AccountID: "123456789012",
+			UserARN:   "arn:aws:iam::123456789012:user/gopher",
+		}, nil
+	}
+	tests := []struct {
+		name     string
+		creds    Credentials
+		signedAt time.Time
+		service  string
+		// contentSha256 is the X-Amz-Content-Sha256 header of the signed request.
+		contentSha256        string
+		allowUnsignedPayload bool
+		noLookup             bool
+		modify               func(r *http.Request) []byte
+		expected             events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription
+		expectedErr          bool
+	}{
+		{
+			name: "signed requests return the identity",
+			expected: events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription{
+				AccessKey: "AKIDEXAMPLE",
+				AccountID: "123456789012",
+				UserARN:   "arn:aws:iam::123456789012:user/gopher",
+			},
+		},
+		{
+			name:     "signatures within the allowed clock skew are valid",
+			signedAt: now.Add(-4 * time.Minute),
+			expected: events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription{
+				AccessKey: "AKIDEXAMPLE",
+				AccountID: "123456789012",
+				UserARN:   "arn:aws:iam::123456789012:user/gopher",
+			},
+		},
+		{
+			name:        "old signatures are invalid",
+			signedAt:    now.Add(-6 * time.Minute),
+			expectedErr: true,
+		},
+		{
+			name:        "signatures with the wrong secret access key are invalid",
+			creds:       Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wrong"},
+			expectedErr: true,
+		},
+		{
+			name:        "signatures with unknown access keys are invalid",
+			creds:       Credentials{AccessKeyID: "AKIDUNKNOWN", SecretAccessKey: "secret"},
+			expectedErr: true,
+		},
+		{
+			name:        "signatures for other services are invalid",
+			service:     "execute-api",
+			expectedErr: true,
+		},
+		{
+			name: "unsigned requests are invalid",
+			modify: func(r *http.Request) []byte {
+				r.Header.Del("Authorization")
+				return []byte(`{"name":"gopher"}`)
+			},
+			expectedErr: true,
+		},
+		{
+			name: "modified bodies are invalid",
+			modify: func(r *http.Request) []byte {
+				return []byte(`{"name":"attacker"}`)
+			},
+			expectedErr: true,
+		},
+		{
+			name:          "signed content hashes that match the body are valid",
+			contentSha256: hashHex([]byte(`{"name":"gopher"}`)),
+			expected: events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription{
+				AccessKey: "AKIDEXAMPLE",
+				AccountID: "123456789012",
+				UserARN:   "arn:aws:iam::123456789012:user/gopher",
+			},
+		},
+		{
+			name:          "modified bodies with a valid signature of the content hash are invalid",
+			contentSha256: hashHex([]byte(`{"name":"gopher"}`)),
+			modify: func(r *http.Request) []byte {
+				return []byte(`{"name":"attacker"}`)
+			},
+			expectedErr: true,
+		},
+		{
+			name:          "unsigned payloads are invalid by default",
+			contentSha256: "UNSIGNED-PAYLOAD",
+			expectedErr:   true,
+		},
+		{
+			name:                 "unsigned payloads are valid if allowed",
+			contentSha256:        "UNSIGNED-PAYLOAD",
+			allowUnsignedPayload: true,
+			modify: func(r *http.Request) []byte {
+				return []byte(`{"name":"attacker"}`)
+			},
+			expected: events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription{
+				AccessKey: "AKIDEXAMPLE",
+				AccountID: "123456789012",
+				UserARN:   "arn:aws:iam::123456789012:user/gopher",
+			},
+		},
+		{
+			name:        "verifiers without a lookup function return an error",
+			noLookup:    true,
+			expectedErr: true,
+		},
+		{
+			name: "modified querystrings are invalid",
+			modify: func(r *http.Request) []byte {
+				r.URL.RawQuery = "a=2"
+				return []byte(`{"name":"gopher"}`)
+			},
+			expectedErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			if tt.creds.AccessKeyID == "" {
+				tt.creds = creds
+			}
+			if tt.signedAt.IsZero() {
+				tt.signedAt = now
+			}
+			if tt.service == "" {
+				tt.service = "lambda"
+			}
+			body := []byte(`{"name":"gopher"}`)
+			r, err := http.NewRequest(http.MethodPost, "https://abcdefg.lambda-url.us-east-1.on.aws/orders?a=1", bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			r.Header.Set("Content-Type", "application/json")
+			if tt.contentSha256 != "" {
+				r.Header.Set("X-Amz-Content-Sha256", tt.contentSha256)
+			}
+			signRequest(r, body, tt.creds, "us-east-1", tt.service, tt.signedAt)
+			if tt.modify != nil {
+				body = tt.modify(r)
+			}
+			v := SigV4Verifier{Lookup: lookup, Region: "us-east-1", Service: "lambda", AllowUnsignedPayload: tt.allowUnsignedPayload, now: func() time.Time { return now }}
+			if tt.noLookup {
+				v.Lookup = nil
+			}
+
+			// Act.
+			actual, err := v.Verify(r, body)
+
+			// Assert.
+			if tt.expectedErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.expectedErr, err)
+			}
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package awsapigatewayv2handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxResponseSize is the size limit of synchronous Lambda responses, less space for the status code,
+// headers and the rest of the response event.
+const maxResponseSize = 6*1024*1024 - 64*1024
+
+// StaticFSOptions configures a StaticFS.
+type StaticFSOptions struct {
+	// CacheControl is the Cache-Control header of files that don't have hashed names. Defaults to no-cache,
+	// so that clients revalidate files using their ETag.
+	CacheControl string
+	// HashedName matches the names of files that include a hash of their content, e.g. app.3f2a9c1b.js.
+	// The content of these files never changes, so they're cached for a year. If nil, no files are cached
+	// as immutable.
+	HashedName *regexp.Regexp
+}
+
+// NewStaticFS reads all of the files in fsys, so that they can be served without reading them again.
+// Content types, ETags and gzip compressed variants of each file are calculated up front.
+func NewStaticFS(fsys fs.FS, opts StaticFSOptions) (*StaticFS, error) {
+	if opts.CacheControl == "" {
+		opts.CacheControl = "no-cache"
+	}
+	s := &StaticFS{files: map[string]*staticFile{}}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		s.files[name] = newStaticFile(name, data, info.ModTime(), opts)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static files: %w", err)
+	}
+	return s, nil
+}
+
+// StaticFS serves files from memory. It's an alternative to http.FileServer for files embedded in a
+// Lambda function, e.g. with embed.FS.
+//
+// Responses never exceed the Lambda response size limit. Range requests are truncated to fit, and
+// files that are too large to return in a single response have to be requested in ranges.
+type StaticFS struct {
+	files map[string]*staticFile
+}
+
+type staticFile struct {
+	contentType  string
+	cacheControl string
+	modTime      time.Time
+	identity     staticVariant
+	// gzip is nil if compression doesn't reduce the size of the file.
+	gzip *staticVariant
+}
+
+type staticVariant struct {
+	data []byte
+	etag string
+	// fits is true if the variant fits in a Lambda response.
+	fits bool
+}
+
+func newStaticFile(name string, data []byte, modTime time.Time, opts StaticFSOptions) *staticFile {
+	f := &staticFile{
+		contentType:  mime.TypeByExtension(path.Ext(name)),
+		cacheControl: opts.CacheControl,
+		modTime:      modTime,
+	}
+	if f.contentType == "" {
+		f.contentType = http.DetectContentType(data)
+	}
+	if opts.HashedName != nil && opts.HashedName.MatchString(path.Base(name)) {
+		f.cacheControl = "public, max-age=31536000, immutable"
+	}
+	text := isTextType(f.contentType)
+	sum := sha256.Sum256(data)
+	etag := hex.EncodeToString(sum[:16])
+	f.identity = staticVariant{
+		data: data,
+		etag: `"` + etag + `"`,
+		fits: fitLength(data, text, maxResponseSize) == len(data),
+	}
+	var buf bytes.Buffer
+	gw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	gw.Write(data)
+	gw.Close()
+	// Files that are already compressed, such as images, aren't worth compressing again.
+	if buf.Len() < len(data)*9/10 {
+		// Each representation of a file needs a different strong ETag.
+		f.gzip = &staticVariant{
+			data: buf.Bytes(),
+			etag: `"` + etag + `-gzip"`,
+			fits: fitLength(buf.Bytes(), false, maxResponseSize) == buf.Len(),
+		}
+	}
+	return f
+}
+
+// fitLength returns the number of bytes of data that fit within size, once encoded in a response event.
+// Text is returned as a JSON string, unless it's invalid UTF-8, in which case it's base64 encoded, so
+// the larger of the two is used.
+func fitLength(data []byte, text bool, size int) int {
+	if !text {
+		return min(len(data), size/4*3)
+	}
+	var jsonLength int
+	for i, c := range data {
+		jsonLength++
+		if !safeJSON[c] {
+			// Escapes are at most 6 bytes, e.g. \u003c.
+			jsonLength += 5
+		}
+		if max(jsonLength, (i+3)/3*4)+2 > size {
+			return i
+		}
+	}
+	return len(data)
+}
+
+// localRedirect redirects to a path relative to the request, like http.FileServer, so that it works
+// behind http.StripPrefix. http.Redirect would make the path absolute.
+func localRedirect(w http.ResponseWriter, r *http.Request, target string) {
+	if q := r.URL.RawQuery; q != "" {
+		target += "?" + q
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+func (s *StaticFS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if strings.HasSuffix(r.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	}
+	f, ok := s.files[name]
+	if !ok {
+		if _, ok := s.files[path.Join(name, "index.html")]; ok {
+			localRedirect(w, r, path.Base(name)+"/")
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", f.contentType)
+	h.Set("Cache-Control", f.cacheControl)
+	h.Set("Accept-Ranges", "bytes")
+	if !f.modTime.IsZero() {
+		h.Set("Last-Modified", f.modTime.UTC().Format(http.TimeFormat))
+	}
+	v := &f.identity
+	if f.gzip != nil {
+		h.Set("Vary", "Accept-Encoding")
+		// Ranges are served from the uncompressed file.
+		if acceptsGzip(r) && r.Header.Get("Range") == "" && f.gzip.fits {
+			v = f.gzip
+			h.Set("Content-Encoding", "gzip")
+		}
+	}
+	h.Set("ETag", v.etag)
+	if isNotModified(r, h, v.etag) {
+		h.Del("Content-Type")
+		h.Del("Content-Encoding")
+		h.Del("Last-Modified")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if r.Method == http.MethodGet && ifRangeMatches(r, h) {
+		size := int64(len(v.data))
+		ranges, err := parseRange(r.Header.Get("Range"), size)
+		if errors.Is(err, errNoOverlap) {
+			h.Del("Content-Type")
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		// Multiple ranges are ignored, so that the range can be truncated to fit in the response.
+		if err == nil && len(ranges) == 1 {
+			ra := ranges[0]
+			data := v.data[ra.start : ra.start+ra.length]
+			ra.length = int64(fitLength(data, isTextType(f.contentType), maxResponseSize))
+			h.Set("Content-Range", ra.contentRange(size))
+			h.Set("Content-Length", strconv.FormatInt(ra.length, 10))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[:ra.length])
+			return
+		}
+	}
+	if !v.fits {
+		for _, k := range []string{"Cache-Control", "Content-Encoding", "ETag", "Last-Modified", "Vary"} {
+			h.Del(k)
+		}
+		writeProblemDetails(w, http.StatusInternalServerError, "The file is too large to return in a Lambda response, use a Range request.")
+		return
+	}
+	h.Set("Content-Length", strconv.Itoa(len(v.data)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(v.data)
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.EqualFold(strings.TrimSpace(enc), "gzip") {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
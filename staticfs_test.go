@@ -0,0 +1,490 @@
+package awsapigatewayv2handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStaticFS(t *testing.T) {
+	modTime := time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)
+	random := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+	large := make([]byte, 7*1024*1024)
+	rand.New(rand.NewSource(2)).Read(large)
+	html := strings.Repeat("<p>Hello, World</p>\n", 100)
+	fsys := fstest.MapFS{
+		"index.html":         {Data: []byte(html), ModTime: modTime},
+		"docs/index.html":    {Data: []byte("<h1>Docs</h1>")},
+		"app.3f2a9c1b.js":    {Data: []byte("console.log(1)")},
+		"cat.jpg":            {Data: random},
+		"notes":              {Data: []byte("Notes")},
+		"downloads/large.db": {Data: large},
+	}
+	s, err := NewStaticFS(fsys, StaticFSOptions{HashedName: regexp.MustCompile(`\.[0-9a-f]{8,}\.(css|js)$`)})
+	if err != nil {
+		t.Fatalf("failed to create StaticFS: %v", err)
+	}
+	get := func(target string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+	indexETag := get("/", nil).Header().Get("ETag")
+	gzipETag := get("/", map[string]string{"Accept-Encoding": "gzip"}).Header().Get("ETag")
+	tests := []struct {
+		name            string
+		method          string
+		target          string
+		headers         map[string]string
+		expectedStatus  int
+		expectedHeaders map[string]string
+		expectedBody    []byte
+	}{
+		{
+			name:           "directories serve index.html",
+			target:         "/",
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Cache-Control":  "no-cache",
+				"Content-Length": "2000",
+				"Content-Type":   "text/html; charset=utf-8",
+				"Etag":           indexETag,
+				"Last-Modified":  "Wed, 21 Oct 2015 07:28:00 GMT",
+				"Vary":           "Accept-Encoding",
+			},
+			expectedBody: []byte(html),
+		},
+		{
+			name:           "directories without a trailing slash are redirected",
+			target:         "/docs?page=2",
+			expectedStatus: http.StatusMovedPermanently,
+			expectedHeaders: map[string]string{
+				"Location": "docs/?page=2",
+			},
+		},
+		{
+			name:           "redirects can't be to another host",
+			target:         "//docs",
+			expectedStatus: http.StatusMovedPermanently,
+			expectedHeaders: map[string]string{
+				"Location": "docs/",
+			},
+		},
+		{
+			name:           "compressed files are served to clients that accept gzip",
+			target:         "/index.html",
+			headers:        map[string]string{"Accept-Encoding": "br, gzip"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":    "bytes",
+				"Cache-Control":    "no-cache",
+				"Content-Encoding": "gzip",
+				"Content-Type":     "text/html; charset=utf-8",
+				"Etag":             gzipETag,
+				"Last-Modified":    "Wed, 21 Oct 2015 07:28:00 GMT",
+				"Vary":             "Accept-Encoding",
+			},
+			expectedBody: []byte(html),
+		},
+		{
+			name:           "clients can refuse gzip",
+			target:         "/index.html",
+			headers:        map[string]string{"Accept-Encoding": "gzip;q=0"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Cache-Control":  "no-cache",
+				"Content-Length": "2000",
+				"Content-Type":   "text/html; charset=utf-8",
+				"Etag":           indexETag,
+				"Last-Modified":  "Wed, 21 Oct 2015 07:28:00 GMT",
+				"Vary":           "Accept-Encoding",
+			},
+			expectedBody: []byte(html),
+		},
+		{
+			name:           "files that don't compress well aren't compressed",
+			target:         "/cat.jpg",
+			headers:        map[string]string{"Accept-Encoding": "gzip"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Cache-Control":  "no-cache",
+				"Content-Length": "65536",
+				"Content-Type":   "image/jpeg",
+				"Etag":           get("/cat.jpg", nil).Header().Get("ETag"),
+			},
+			expectedBody: random,
+		},
+		{
+			name:           "files with hashed names are immutable",
+			target:         "/app.3f2a9c1b.js",
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Cache-Control":  "public, max-age=31536000, immutable",
+				"Content-Length": "14",
+				"Content-Type":   "text/javascript; charset=utf-8",
+				"Etag":           get("/app.3f2a9c1b.js", nil).Header().Get("ETag"),
+			},
+			expectedBody: []byte("console.log(1)"),
+		},
+		{
+			name:           "content types are detected if the extension is unknown",
+			target:         "/notes",
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Cache-Control":  "no-cache",
+				"Content-Length": "5",
+				"Content-Type":   "text/plain; charset=utf-8",
+				"Etag":           get("/notes", nil).Header().Get("ETag"),
+			},
+			expectedBody: []byte("Notes"),
+		},
+		{
+			name:           "matching If-None-Match headers return 304 Not Modified",
+			target:         "/",
+			headers:        map[string]string{"If-None-Match": indexETag},
+			expectedStatus: http.StatusNotModified,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges": "bytes",
+				"Cache-Control": "no-cache",
+				"Etag":          indexETag,
+				"Vary":          "Accept-Encoding",
+			},
+		},
+		{
+			name:           "If-None-Match headers must match the ETag of the compressed file",
+			target:         "/",
+			headers:        map[string]string{"If-None-Match": indexETag, "Accept-Encoding": "gzip"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":    "bytes",
+				"Cache-Control":    "no-cache",
+				"Content-Encoding": "gzip",
+				"Content-Type":     "text/html; charset=utf-8",
+				"Etag":             gzipETag,
+				"Last-Modified":    "Wed, 21 Oct 2015 07:28:00 GMT",
+				"Vary":             "Accept-Encoding",
+			},
+			expectedBody: []byte(html),
+		},
+		{
+			name:           "If-Modified-Since headers return 304 Not Modified",
+			target:         "/",
+			headers:        map[string]string{"If-Modified-Since": "Wed, 21 Oct 2015 07:28:00 GMT"},
+			expectedStatus: http.StatusNotModified,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges": "bytes",
+				"Cache-Control": "no-cache",
+				"Etag":          indexETag,
+				"Vary":          "Accept-Encoding",
+			},
+		},
+		{
+			name:           "ranges are served from the uncompressed file",
+			target:         "/",
+			headers:        map[string]string{"Range": "bytes=3-7", "Accept-Encoding": "gzip"},
+			expectedStatus: http.StatusPartialContent,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Cache-Control":  "no-cache",
+				"Content-Length": "5",
+				"Content-Range":  "bytes 3-7/2000",
+				"Content-Type":   "text/html; charset=utf-8",
+				"Etag":           indexETag,
+				"Last-Modified":  "Wed, 21 Oct 2015 07:28:00 GMT",
+				"Vary":           "Accept-Encoding",
+			},
+			expectedBody: []byte("Hello"),
+		},
+		{
+			name:           "ranges that start after the end of the file can't be satisfied",
+			target:         "/notes",
+			headers:        map[string]string{"Range": "bytes=10-"},
+			expectedStatus: http.StatusRequestedRangeNotSatisfiable,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges": "bytes",
+				"Cache-Control": "no-cache",
+				"Content-Range": "bytes */5",
+				"Etag":          get("/notes", nil).Header().Get("ETag"),
+			},
+		},
+		{
+			name:           "ranges are truncated to fit in a Lambda response",
+			target:         "/downloads/large.db",
+			headers:        map[string]string{"Range": "bytes=0-"},
+			expectedStatus: http.StatusPartialContent,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Cache-Control":  "no-cache",
+				"Content-Length": "4669440",
+				"Content-Range":  "bytes 0-4669439/7340032",
+				"Content-Type":   "application/octet-stream",
+				"Etag":           get("/downloads/large.db", map[string]string{"Range": "bytes=0-0"}).Header().Get("ETag"),
+			},
+			expectedBody: large[:4669440],
+		},
+		{
+			name:           "files that are too large for a Lambda response must be requested in ranges",
+			target:         "/downloads/large.db",
+			expectedStatus: http.StatusInternalServerError,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges": "bytes",
+				"Content-Type":  "application/problem+json",
+			},
+			expectedBody: []byte(`{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"The file is too large to return in a Lambda response, use a Range request."}`),
+		},
+		{
+			name:           "HEAD requests don't return a body",
+			method:         http.MethodHead,
+			target:         "/notes",
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Accept-Ranges":  "bytes",
+				"Cache-Control":  "no-cache",
+				"Content-Length": "5",
+				"Content-Type":   "text/plain; charset=utf-8",
+				"Etag":           get("/notes", nil).Header().Get("ETag"),
+			},
+		},
+		{
+			name:           "missing files return 404 Not Found",
+			target:         "/missing.html",
+			expectedStatus: http.StatusNotFound,
+			expectedHeaders: map[string]string{
+				"Content-Type":           "text/plain; charset=utf-8",
+				"X-Content-Type-Options": "nosniff",
+			},
+			expectedBody: []byte("404 page not found\n"),
+		},
+		{
+			name:           "other methods aren't allowed",
+			method:         http.MethodPost,
+			target:         "/notes",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedHeaders: map[string]string{
+				"Allow":                  "GET, HEAD",
+				"Content-Type":           "text/plain; charset=utf-8",
+				"X-Content-Type-Options": "nosniff",
+			},
+			expectedBody: []byte("Method Not Allowed\n"),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, tt.target, nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			// Act.
+			s.ServeHTTP(w, r)
+
+			// Assert.
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			actualHeaders := map[string]string{}
+			for k := range w.Header() {
+				actualHeaders[k] = w.Header().Get(k)
+			}
+			if actualHeaders["Content-Encoding"] == "gzip" {
+				// The length of the compressed file isn't important.
+				delete(actualHeaders, "Content-Length")
+			}
+			if diff := cmp.Diff(tt.expectedHeaders, actualHeaders); diff != "" {
+				t.Error(diff)
+			}
+			body := w.Body.Bytes()
+			if w.Header().Get("Content-Encoding") == "gzip" {
+				gr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("failed to read gzip body: %v", err)
+				}
+				body, _ = io.ReadAll(gr)
+			}
+			if !bytes.Equal(body, tt.expectedBody) {
+				t.Errorf("expected body of %d bytes, got %d bytes", len(tt.expectedBody), len(body))
+			}
+		})
+	}
+	t.Run("responses fit in a Lambda response", func(t *testing.T) {
+		// Arrange.
+		lh := NewLambdaHandler(s)
+
+		// Act.
+		payload, err := lh.Invoke(context.Background(), []byte(`{"rawPath":"/downloads/large.db","headers":{"range":"bytes=100-"},"requestContext":{"http":{"method":"GET"}}}`))
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(payload) > 6*1024*1024 {
+			t.Errorf("expected response to fit in 6MB, got %d bytes", len(payload))
+		}
+	})
+}
+
+func TestStaticFSStripPrefix(t *testing.T) {
+	// Arrange.
+	s, err := NewStaticFS(fstest.MapFS{
+		"docs/index.html": &fstest.MapFile{Data: []byte("<h1>Docs</h1>")},
+	}, StaticFSOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := http.StripPrefix("/assets", s)
+	r := httptest.NewRequest(http.MethodGet, "/assets/docs", nil)
+	w := httptest.NewRecorder()
+
+	// Act.
+	h.ServeHTTP(w, r)
+
+	// Assert.
+	if w.Code != http.StatusMovedPermanently {
+		t.Errorf("expected status %d, got %d", http.StatusMovedPermanently, w.Code)
+	}
+	location, err := r.URL.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid location: %v", err)
+	}
+	if location.Path != "/assets/docs/" {
+		t.Errorf("expected redirect to /assets/docs/, got %q", location.Path)
+	}
+}
+
+func TestStaticFSHashedName(t *testing.T) {
+	hashedName := regexp.MustCompile(`\.[0-9a-f]{8,}\.(css|js)$`)
+	tests := []struct {
+		name       string
+		hashedName *regexp.Regexp
+		file       string
+		expected   string
+	}{
+		{
+			name:     "files aren't immutable by default",
+			file:     "app.3f2a9c1b.js",
+			expected: "no-cache",
+		},
+		{
+			name:       "files with hashed names are immutable",
+			hashedName: hashedName,
+			file:       "app.3f2a9c1b.js",
+			expected:   "public, max-age=31536000, immutable",
+		},
+		{
+			name:       "dates aren't hashes",
+			hashedName: hashedName,
+			file:       "report-20240101.pdf",
+			expected:   "no-cache",
+		},
+		{
+			name:       "words aren't hashes",
+			hashedName: hashedName,
+			file:       "CHANGELOG-UNRELEASED.md",
+			expected:   "no-cache",
+		},
+		{
+			name:       "dates before other extensions aren't hashes",
+			hashedName: hashedName,
+			file:       "backup.20240101.tar",
+			expected:   "no-cache",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			fsys := fstest.MapFS{tt.file: {Data: []byte("data")}}
+			s, err := NewStaticFS(fsys, StaticFSOptions{HashedName: tt.hashedName})
+			if err != nil {
+				t.Fatalf("failed to create StaticFS: %v", err)
+			}
+			w := httptest.NewRecorder()
+
+			// Act.
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+tt.file, nil))
+
+			// Assert.
+			if actual := w.Header().Get("Cache-Control"); actual != tt.expected {
+				t.Errorf("expected Cache-Control %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFitLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		text     bool
+		size     int
+		expected int
+	}{
+		{
+			name:     "binary data is base64 encoded",
+			data:     "0123456789",
+			size:     8,
+			expected: 6,
+		},
+		{
+			name:     "text is quoted",
+			data:     "0123456789",
+			text:     true,
+			size:     18,
+			expected: 10,
+		},
+		{
+			name:     "text may be base64 encoded",
+			data:     "0123456789",
+			text:     true,
+			size:     12,
+			expected: 6,
+		},
+		{
+			name:     "text may need escaping",
+			data:     "<p>",
+			text:     true,
+			size:     14,
+			expected: 2,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Act.
+			actual := fitLength([]byte(tt.data), tt.text, tt.size)
+
+			// Assert.
+			if actual != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, actual)
+			}
+		})
+	}
+}
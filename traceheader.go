@@ -0,0 +1,110 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// TraceHeader is a parsed AWS X-Ray trace header, e.g.
+// Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1
+//
+// See https://docs.aws.amazon.com/xray/latest/devguide/xray-concepts.html#xray-concepts-tracingheader
+type TraceHeader struct {
+	// Root is the trace ID.
+	Root string
+	// Parent is the ID of the parent segment, if any.
+	Parent string
+	// Sampled is true if the trace is sampled.
+	Sampled bool
+}
+
+// ParseTraceHeader parses an X-Amzn-Trace-Id header. It returns false if the header has no root trace ID.
+func ParseTraceHeader(s string) (h TraceHeader, ok bool) {
+	for _, part := range strings.Split(s, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "Root":
+			h.Root = v
+		case "Parent":
+			h.Parent = v
+		case "Sampled":
+			h.Sampled = v == "1"
+		}
+	}
+	return h, h.Root != ""
+}
+
+// String returns the header in X-Amzn-Trace-Id format.
+func (h TraceHeader) String() string {
+	var sb strings.Builder
+	sb.WriteString("Root=")
+	sb.WriteString(h.Root)
+	if h.Parent != "" {
+		sb.WriteString(";Parent=")
+		sb.WriteString(h.Parent)
+	}
+	if h.Sampled {
+		sb.WriteString(";Sampled=1")
+	} else {
+		sb.WriteString(";Sampled=0")
+	}
+	return sb.String()
+}
+
+// TraceParent returns the header in W3C Trace Context traceparent format. It returns false if the trace ID
+// or parent ID can't be converted.
+//
+// See https://www.w3.org/TR/trace-context/#traceparent-header
+func (h TraceHeader) TraceParent() (traceParent string, ok bool) {
+	// X-Ray trace IDs are made up of a version, an 8 digit hex timestamp, and a 24 digit hex ID.
+	version, id, _ := strings.Cut(h.Root, "-")
+	traceID := strings.Replace(id, "-", "", 1)
+	if version != "1" || len(traceID) != 32 || !isLowerHex(traceID) || len(h.Parent) != 16 || !isLowerHex(h.Parent) {
+		return "", false
+	}
+	flags := "00"
+	if h.Sampled {
+		flags = "01"
+	}
+	return "00-" + traceID + "-" + h.Parent + "-" + flags, true
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !(s[i] >= '0' && s[i] <= '9') && !(s[i] >= 'a' && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+type traceHeaderContextKey struct{}
+
+// GetTraceHeader returns the X-Ray trace header of the current invocation. The header is read from the
+// Lambda context, which contains the Lambda-Runtime-Trace-Id of the invocation, or from the
+// X-Amzn-Trace-Id request header.
+func GetTraceHeader(ctx context.Context) (h TraceHeader, ok bool) {
+	h, ok = ctx.Value(traceHeaderContextKey{}).(TraceHeader)
+	return
+}
+
+func getTraceHeader(ctx context.Context, e events.APIGatewayV2HTTPRequest) (h TraceHeader, ok bool) {
+	// The aws-lambda-go library stores the Lambda-Runtime-Trace-Id using a string key.
+	if s, _ := ctx.Value("x-amzn-trace-id").(string); s != "" {
+		if h, ok = ParseTraceHeader(s); ok {
+			return
+		}
+	}
+	return ParseTraceHeader(getHeader(e.Headers, "x-amzn-trace-id"))
+}
+
+// WithTraceParent adds a W3C traceparent header to requests, converted from the X-Ray trace header, so
+// that OpenTelemetry HTTP middleware continues the trace. Requests that already have a traceparent header
+// are not modified.
+func WithTraceParent() Option {
+	return func(lh *LambdaHandler) {
+		lh.traceParent = true
+	}
+}
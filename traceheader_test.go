@@ -0,0 +1,217 @@
+package awsapigatewayv2handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTraceHeader(t *testing.T) {
+	tests := []struct {
+		input      string
+		expected   TraceHeader
+		expectedOK bool
+	}{
+		{
+			input: "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1",
+			expected: TraceHeader{
+				Root:    "1-5759e988-bd862e3fe1be46a994272793",
+				Parent:  "53995c3f42cd8ad8",
+				Sampled: true,
+			},
+			expectedOK: true,
+		},
+		{
+			input: "Root=1-5759e988-bd862e3fe1be46a994272793; Sampled=0; Lineage=a87bd80c:0",
+			expected: TraceHeader{
+				Root: "1-5759e988-bd862e3fe1be46a994272793",
+			},
+			expectedOK: true,
+		},
+		{
+			input:      "Parent=53995c3f42cd8ad8;Sampled=1",
+			expected:   TraceHeader{Parent: "53995c3f42cd8ad8", Sampled: true},
+			expectedOK: false,
+		},
+		{
+			input:      "",
+			expectedOK: false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			// Act.
+			actual, ok := ParseTraceHeader(tt.input)
+
+			// Assert.
+			if ok != tt.expectedOK {
+				t.Errorf("expected ok %v, got %v", tt.expectedOK, ok)
+			}
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestTraceHeaderString(t *testing.T) {
+	// Arrange.
+	h := TraceHeader{Root: "1-5759e988-bd862e3fe1be46a994272793", Parent: "53995c3f42cd8ad8", Sampled: true}
+
+	// Act.
+	actual := h.String()
+
+	// Assert.
+	expected := "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+	if actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestTraceParent(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     TraceHeader
+		expected   string
+		expectedOK bool
+	}{
+		{
+			name:       "sampled",
+			header:     TraceHeader{Root: "1-5759e988-bd862e3fe1be46a994272793", Parent: "53995c3f42cd8ad8", Sampled: true},
+			expected:   "00-5759e988bd862e3fe1be46a994272793-53995c3f42cd8ad8-01",
+			expectedOK: true,
+		},
+		{
+			name:       "not sampled",
+			header:     TraceHeader{Root: "1-5759e988-bd862e3fe1be46a994272793", Parent: "53995c3f42cd8ad8"},
+			expected:   "00-5759e988bd862e3fe1be46a994272793-53995c3f42cd8ad8-00",
+			expectedOK: true,
+		},
+		{
+			name:       "no parent",
+			header:     TraceHeader{Root: "1-5759e988-bd862e3fe1be46a994272793", Sampled: true},
+			expectedOK: false,
+		},
+		{
+			name:       "invalid root",
+			header:     TraceHeader{Root: "2-5759e988-bd862e3fe1be46a994272793", Parent: "53995c3f42cd8ad8"},
+			expectedOK: false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Act.
+			actual, ok := tt.header.TraceParent()
+
+			// Assert.
+			if ok != tt.expectedOK {
+				t.Errorf("expected ok %v, got %v", tt.expectedOK, ok)
+			}
+			if actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTraceHeaderPropagation(t *testing.T) {
+	const runtimeTraceID = "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+	const requestTraceID = "Root=1-63441c4a-abcdef012345678912345678;Parent=0123456789abcdef;Sampled=0"
+	tests := []struct {
+		name                string
+		ctx                 context.Context
+		headers             map[string]string
+		opts                []Option
+		expectedHeader      TraceHeader
+		expectedOK          bool
+		expectedTraceParent string
+	}{
+		{
+			name:    "the Lambda context takes precedence over the request header",
+			ctx:     context.WithValue(context.Background(), "x-amzn-trace-id", runtimeTraceID),
+			headers: map[string]string{"x-amzn-trace-id": requestTraceID},
+			expectedHeader: TraceHeader{
+				Root:    "1-5759e988-bd862e3fe1be46a994272793",
+				Parent:  "53995c3f42cd8ad8",
+				Sampled: true,
+			},
+			expectedOK: true,
+		},
+		{
+			name:    "the request header is used if the Lambda context has no trace ID",
+			ctx:     context.Background(),
+			headers: map[string]string{"x-amzn-trace-id": requestTraceID},
+			expectedHeader: TraceHeader{
+				Root:   "1-63441c4a-abcdef012345678912345678",
+				Parent: "0123456789abcdef",
+			},
+			expectedOK: true,
+		},
+		{
+			name:       "there may be no trace header",
+			ctx:        context.Background(),
+			expectedOK: false,
+		},
+		{
+			name: "a traceparent header can be added",
+			ctx:  context.WithValue(context.Background(), "x-amzn-trace-id", runtimeTraceID),
+			opts: []Option{WithTraceParent()},
+			expectedHeader: TraceHeader{
+				Root:    "1-5759e988-bd862e3fe1be46a994272793",
+				Parent:  "53995c3f42cd8ad8",
+				Sampled: true,
+			},
+			expectedOK:          true,
+			expectedTraceParent: "00-5759e988bd862e3fe1be46a994272793-53995c3f42cd8ad8-01",
+		},
+		{
+			name:    "an existing traceparent header is not replaced",
+			ctx:     context.WithValue(context.Background(), "x-amzn-trace-id", runtimeTraceID),
+			headers: map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+			opts:    []Option{WithTraceParent()},
+			expectedHeader: TraceHeader{
+				Root:    "1-5759e988-bd862e3fe1be46a994272793",
+				Parent:  "53995c3f42cd8ad8",
+				Sampled: true,
+			},
+			expectedOK:          true,
+			expectedTraceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange.
+			var actual TraceHeader
+			var actualOK bool
+			var actualTraceParent string
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actual, actualOK = GetTraceHeader(r.Context())
+				actualTraceParent = r.Header.Get("traceparent")
+			})
+			lh := NewLambdaHandler(h, tt.opts...)
+
+			// Act.
+			_, err := lh.Handle(tt.ctx, events.APIGatewayV2HTTPRequest{RawPath: "/", Headers: tt.headers})
+
+			// Assert.
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actualOK != tt.expectedOK {
+				t.Errorf("expected ok %v, got %v", tt.expectedOK, actualOK)
+			}
+			if diff := cmp.Diff(tt.expectedHeader, actual); diff != "" {
+				t.Error(diff)
+			}
+			if actualTraceParent != tt.expectedTraceParent {
+				t.Errorf("expected traceparent %q, got %q", tt.expectedTraceParent, actualTraceParent)
+			}
+		})
+	}
+}
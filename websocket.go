@@ -0,0 +1,269 @@
+package awsapigatewayv2handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// WebSocketConnections posts messages to, and disconnects, API Gateway WebSocket connections.
+type WebSocketConnections interface {
+	PostToConnection(ctx context.Context, connectionID string, data []byte) error
+	DeleteConnection(ctx context.Context, connectionID string) error
+}
+
+// WebSocketConnection is a client connected to an API Gateway WebSocket API.
+type WebSocketConnection struct {
+	ID          string
+	ConnectedAt time.Time
+	// Request is converted from the event. The $connect event includes the headers and querystring of
+	// the client's request.
+	Request     *http.Request
+	connections WebSocketConnections
+}
+
+// Send a message to the connection.
+func (c WebSocketConnection) Send(ctx context.Context, data []byte) error {
+	return c.connections.PostToConnection(ctx, c.ID, data)
+}
+
+// Close disconnects the connection.
+func (c WebSocketConnection) Close(ctx context.Context) error {
+	return c.connections.DeleteConnection(ctx, c.ID)
+}
+
+type webSocketConnectionContextKey struct{}
+
+// GetWebSocketConnection returns the connection associated with the context of a WebSocket request.
+func GetWebSocketConnection(ctx context.Context) (c WebSocketConnection, ok bool) {
+	p, ok := ctx.Value(webSocketConnectionContextKey{}).(*WebSocketConnection)
+	if !ok {
+		return
+	}
+	return *p, true
+}
+
+// WebSocketHandler routes API Gateway WebSocket API events to callbacks.
+//
+// Events are converted to HTTP requests with a path of "/". The $connect and $disconnect events use the
+// GET method, and messages use the POST method.
+type WebSocketHandler struct {
+	// OnConnect is called when a client connects. Return a *WebSocketRejectionError to reject the
+	// connection with a status code, e.g. 401 Unauthorized. Other errors are returned from the Lambda
+	// function. Use GetWebSocketConnection(r.Context()) to get the connection.
+	OnConnect func(r *http.Request) error
+	// OnMessage is called when a client sends a message.
+	OnMessage func(conn WebSocketConnection, data []byte) error
+	// OnDisconnect is called when a client disconnects. The connection can no longer receive messages.
+	OnDisconnect func(conn WebSocketConnection) error
+	// Connections is used to send messages to connections. If nil, a WebSocketManagementClient for the
+	// domain name and stage of the event is used.
+	Connections WebSocketConnections
+}
+
+func (wh WebSocketHandler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	var e events.APIGatewayWebsocketProxyRequest
+	err := json.Unmarshal(payload, &e)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := wh.Handle(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
+
+func (wh WebSocketHandler) Handle(ctx context.Context, e events.APIGatewayWebsocketProxyRequest) (resp events.APIGatewayProxyResponse, err error) {
+	conn := WebSocketConnection{
+		ID:          e.RequestContext.ConnectionID,
+		ConnectedAt: time.UnixMilli(e.RequestContext.ConnectedAt),
+		connections: wh.Connections,
+	}
+	if conn.connections == nil {
+		conn.connections = NewWebSocketManagementClient(fmt.Sprintf("https://%s/%s", e.RequestContext.DomainName, e.RequestContext.Stage))
+	}
+	v2 := convertWebSocketEvent(e)
+	r, err := LambdaHandler{}.convertLambdaEventToHTTPRequest(v2)
+	if err != nil {
+		// Events that can't be converted get a 400 response, like the LambdaHandler.
+		var re *RequestError
+		if !errors.As(err, &re) {
+			return
+		}
+		v2Resp, err := DefaultRequestErrorHandler(ctx, v2, re)
+		return events.APIGatewayProxyResponse{
+			StatusCode: v2Resp.StatusCode,
+			Headers:    v2Resp.Headers,
+			Body:       v2Resp.Body,
+		}, err
+	}
+	// The context stores a pointer, so that the connection it returns includes the request.
+	conn.Request = r.WithContext(context.WithValue(ctx, webSocketConnectionContextKey{}, &conn))
+
+	switch e.RequestContext.EventType {
+	case "CONNECT":
+		if wh.OnConnect != nil {
+			err = wh.OnConnect(conn.Request)
+		}
+		var rejection *WebSocketRejectionError
+		if errors.As(err, &rejection) {
+			resp.StatusCode = rejection.StatusCode
+			resp.Body = http.StatusText(rejection.StatusCode)
+			return resp, nil
+		}
+	case "MESSAGE":
+		if wh.OnMessage != nil {
+			var data []byte
+			data, err = io.ReadAll(conn.Request.Body)
+			if err != nil {
+				return
+			}
+			err = wh.OnMessage(conn, data)
+		}
+	case "DISCONNECT":
+		if wh.OnDisconnect != nil {
+			err = wh.OnDisconnect(conn)
+		}
+	default:
+		err = fmt.Errorf("unknown WebSocket event type %q", e.RequestContext.EventType)
+	}
+	if err != nil {
+		return
+	}
+	resp.StatusCode = http.StatusOK
+	return
+}
+
+func convertWebSocketEvent(e events.APIGatewayWebsocketProxyRequest) (v2 events.APIGatewayV2HTTPRequest) {
+	method := http.MethodGet
+	if e.RequestContext.EventType == "MESSAGE" {
+		method = http.MethodPost
+	}
+	v2.RouteKey = e.RequestContext.RouteKey
+	v2.RawPath = "/"
+	v2.RawQueryString = encodeQuery(e.QueryStringParameters, e.MultiValueQueryStringParameters)
+	v2.Headers = make(map[string]string, len(e.Headers)+len(e.MultiValueHeaders))
+	for k, v := range e.Headers {
+		v2.Headers[k] = v
+	}
+	for k, v := range e.MultiValueHeaders {
+		v2.Headers[k] = strings.Join(v, ",")
+	}
+	v2.Body = e.Body
+	v2.IsBase64Encoded = e.IsBase64Encoded
+	v2.RequestContext = events.APIGatewayV2HTTPRequestContext{
+		RouteKey:   e.RequestContext.RouteKey,
+		AccountID:  e.RequestContext.AccountID,
+		Stage:      e.RequestContext.Stage,
+		RequestID:  e.RequestContext.RequestID,
+		APIID:      e.RequestContext.APIID,
+		DomainName: e.RequestContext.DomainName,
+		Time:       e.RequestContext.RequestTime,
+		TimeEpoch:  e.RequestContext.RequestTimeEpoch,
+		HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+			Method:    method,
+			Path:      "/",
+			SourceIP:  e.RequestContext.Identity.SourceIP,
+			UserAgent: e.RequestContext.Identity.UserAgent,
+		},
+	}
+	return
+}
+
+func encodeQuery(single map[string]string, multi map[string][]string) string {
+	q := make(url.Values, len(multi))
+	for k, v := range multi {
+		q[k] = v
+	}
+	for k, v := range single {
+		if _, ok := q[k]; !ok {
+			q.Set(k, v)
+		}
+	}
+	return q.Encode()
+}
+
+// NewWebSocketManagementClient creates a client for the API Gateway Management API, e.g.
+// https://abcdef1234.execute-api.eu-west-2.amazonaws.com/production
+//
+// The region is read from the AWS_REGION environment variable, and credentials are read from the
+// environment.
+func NewWebSocketManagementClient(endpoint string) *WebSocketManagementClient {
+	return &WebSocketManagementClient{
+		Endpoint:    strings.TrimSuffix(endpoint, "/"),
+		Region:      os.Getenv("AWS_REGION"),
+		Credentials: EnvironmentCredentials,
+		Client:      http.DefaultClient,
+	}
+}
+
+// WebSocketManagementClient implements WebSocketConnections using the API Gateway Management API.
+type WebSocketManagementClient struct {
+	Endpoint    string
+	Region      string
+	Credentials CredentialsProvider
+	Client      *http.Client
+}
+
+func (c *WebSocketManagementClient) PostToConnection(ctx context.Context, connectionID string, data []byte) error {
+	return c.do(ctx, http.MethodPost, connectionID, data)
+}
+
+func (c *WebSocketManagementClient) DeleteConnection(ctx context.Context, connectionID string) error {
+	return c.do(ctx, http.MethodDelete, connectionID, nil)
+}
+
+func (c *WebSocketManagementClient) do(ctx context.Context, method, connectionID string, body []byte) error {
+	creds, err := c.Credentials(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, method, c.Endpoint+"/@connections/"+url.PathEscape(connectionID), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	signRequest(r, body, creds, c.Region, "execute-api", time.Now())
+	resp, err := c.Client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &WebSocketManagementError{ConnectionID: connectionID, StatusCode: resp.StatusCode, Message: string(msg)}
+	}
+	return nil
+}
+
+// WebSocketRejectionError is returned by OnConnect to reject a connection, so that API Gateway returns the
+// status code to the client, instead of counting a Lambda function error.
+type WebSocketRejectionError struct {
+	StatusCode int
+}
+
+func (e *WebSocketRejectionError) Error() string {
+	return fmt.Sprintf("websocket connection rejected: status %d", e.StatusCode)
+}
+
+// WebSocketManagementError is returned when the API Gateway Management API returns an error. A
+// StatusCode of 410 Gone means that the connection no longer exists.
+type WebSocketManagementError struct {
+	ConnectionID string
+	StatusCode   int
+	Message      string
+}
+
+func (e *WebSocketManagementError) Error() string {
+	return fmt.Sprintf("websocket connection %q: status %d: %s", e.ConnectionID, e.StatusCode, e.Message)
+}
@@ -0,0 +1,240 @@
+package awsapigatewayv2handler_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/a-h/awsapigatewayv2handler"
+	"github.com/a-h/awsapigatewayv2handler/apigwtest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWebSocketHandler(t *testing.T) {
+	t.Run("connect events include the request", func(t *testing.T) {
+		// Arrange.
+		var called bool
+		wh := awsapigatewayv2handler.WebSocketHandler{
+			OnConnect: func(r *http.Request) error {
+				called = true
+				if token := r.URL.Query().Get("token"); token != "abc" {
+					t.Errorf("expected token abc, got %q", token)
+				}
+				if ua := r.Header.Get("User-Agent"); ua != "test" {
+					t.Errorf("expected user agent test, got %q", ua)
+				}
+				conn, ok := awsapigatewayv2handler.GetWebSocketConnection(r.Context())
+				if !ok {
+					t.Fatal("expected connection in context")
+				}
+				if conn.ID != "conn1" {
+					t.Errorf("expected connection ID conn1, got %q", conn.ID)
+				}
+				return nil
+			},
+			Connections: apigwtest.NewConnections(),
+		}
+		e := apigwtest.NewWebSocketEvent("CONNECT", "conn1", "")
+		e.Headers = map[string]string{"User-Agent": "test"}
+		e.QueryStringParameters = map[string]string{"token": "abc"}
+
+		// Act.
+		resp, err := wh.Handle(context.Background(), e)
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !called {
+			t.Error("OnConnect was not called")
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected status 200, got %d", resp.StatusCode)
+		}
+	})
+	t.Run("connections can be rejected with a status code", func(t *testing.T) {
+		// Arrange.
+		wh := awsapigatewayv2handler.WebSocketHandler{
+			OnConnect: func(r *http.Request) error {
+				return fmt.Errorf("missing token: %w", &awsapigatewayv2handler.WebSocketRejectionError{StatusCode: http.StatusUnauthorized})
+			},
+			Connections: apigwtest.NewConnections(),
+		}
+
+		// Act.
+		resp, err := wh.Handle(context.Background(), apigwtest.NewWebSocketEvent("CONNECT", "conn1", ""))
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", resp.StatusCode)
+		}
+	})
+	t.Run("other connect errors are returned", func(t *testing.T) {
+		// Arrange.
+		expectedErr := errors.New("unauthorized")
+		wh := awsapigatewayv2handler.WebSocketHandler{
+			OnConnect: func(r *http.Request) error {
+				return expectedErr
+			},
+			Connections: apigwtest.NewConnections(),
+		}
+
+		// Act.
+		_, err := wh.Handle(context.Background(), apigwtest.NewWebSocketEvent("CONNECT", "conn1", ""))
+
+		// Assert.
+		if !errors.Is(err, expectedErr) {
+			t.Errorf("expected error %v, got %v", expectedErr, err)
+		}
+	})
+	t.Run("messages can be sent to connections", func(t *testing.T) {
+		// Arrange.
+		connections := apigwtest.NewConnections()
+		wh := awsapigatewayv2handler.WebSocketHandler{
+			OnMessage: func(conn awsapigatewayv2handler.WebSocketConnection, data []byte) error {
+				return conn.Send(conn.Request.Context(), append([]byte("echo: "), data...))
+			},
+			Connections: connections,
+		}
+		text := apigwtest.NewWebSocketEvent("MESSAGE", "conn1", "hello")
+		binary := apigwtest.NewWebSocketEvent("MESSAGE", "conn1", base64.StdEncoding.EncodeToString([]byte{0, 1}))
+		binary.IsBase64Encoded = true
+
+		// Act.
+		if _, err := wh.Handle(context.Background(), text); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := wh.Handle(context.Background(), binary); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Assert.
+		expected := [][]byte{[]byte("echo: hello"), []byte("echo: \x00\x01")}
+		if diff := cmp.Diff(expected, connections.Get("conn1")); diff != "" {
+			t.Error(diff)
+		}
+	})
+	t.Run("disconnected connections can't receive messages", func(t *testing.T) {
+		// Arrange.
+		connections := apigwtest.NewConnections()
+		var sendErr error
+		wh := awsapigatewayv2handler.WebSocketHandler{
+			OnDisconnect: func(conn awsapigatewayv2handler.WebSocketConnection) error {
+				if err := conn.Close(context.Background()); err != nil {
+					return err
+				}
+				sendErr = conn.Send(context.Background(), []byte("goodbye"))
+				return nil
+			},
+			Connections: connections,
+		}
+
+		// Act.
+		_, err := wh.Handle(context.Background(), apigwtest.NewWebSocketEvent("DISCONNECT", "conn1", ""))
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var mErr *awsapigatewayv2handler.WebSocketManagementError
+		if !errors.As(sendErr, &mErr) || mErr.StatusCode != http.StatusGone {
+			t.Errorf("expected 410 Gone error, got %v", sendErr)
+		}
+		if !connections.IsDeleted("conn1") {
+			t.Error("expected the connection to be deleted")
+		}
+	})
+	t.Run("unknown event types return an error", func(t *testing.T) {
+		wh := awsapigatewayv2handler.WebSocketHandler{Connections: apigwtest.NewConnections()}
+		_, err := wh.Handle(context.Background(), apigwtest.NewWebSocketEvent("UNKNOWN", "conn1", ""))
+		if err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+	t.Run("invalid events return a 400 response", func(t *testing.T) {
+		// Arrange.
+		var called bool
+		wh := awsapigatewayv2handler.WebSocketHandler{
+			OnMessage: func(conn awsapigatewayv2handler.WebSocketConnection, data []byte) error {
+				called = true
+				return nil
+			},
+			Connections: apigwtest.NewConnections(),
+		}
+		e := apigwtest.NewWebSocketEvent("MESSAGE", "conn1", "not base64!")
+		e.IsBase64Encoded = true
+
+		// Act.
+		resp, err := wh.Handle(context.Background(), e)
+
+		// Assert.
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", resp.StatusCode)
+		}
+		if called {
+			t.Error("expected OnMessage not to be called")
+		}
+	})
+}
+
+func TestWebSocketManagementClient(t *testing.T) {
+	// Arrange.
+	var requests []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath()+" "+string(body))
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+			t.Errorf("expected signed request, got Authorization header %q", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("X-Amz-Security-Token") != "token" {
+			t.Errorf("expected security token header")
+		}
+		if strings.HasSuffix(r.URL.Path, "gone=") {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+	}))
+	defer s.Close()
+	c := awsapigatewayv2handler.NewWebSocketManagementClient(s.URL + "/stage/")
+	c.Region = "us-east-1"
+	c.Credentials = func(ctx context.Context) (awsapigatewayv2handler.Credentials, error) {
+		return awsapigatewayv2handler.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"}, nil
+	}
+
+	// Act.
+	postErr := c.PostToConnection(context.Background(), "L0SM9cOFvHcCIhw=", []byte("hello"))
+	deleteErr := c.DeleteConnection(context.Background(), "L0SM9cOFvHcCIhw=")
+	goneErr := c.PostToConnection(context.Background(), "gone=", []byte("hello"))
+
+	// Assert.
+	if postErr != nil {
+		t.Errorf("unexpected post error: %v", postErr)
+	}
+	if deleteErr != nil {
+		t.Errorf("unexpected delete error: %v", deleteErr)
+	}
+	var mErr *awsapigatewayv2handler.WebSocketManagementError
+	if !errors.As(goneErr, &mErr) || mErr.StatusCode != http.StatusGone {
+		t.Errorf("expected 410 Gone error, got %v", goneErr)
+	}
+	expected := []string{
+		"POST /stage/@connections/L0SM9cOFvHcCIhw= hello",
+		"DELETE /stage/@connections/L0SM9cOFvHcCIhw= ",
+		"POST /stage/@connections/gone= hello",
+	}
+	if diff := cmp.Diff(expected, requests); diff != "" {
+		t.Error(diff)
+	}
+}